@@ -0,0 +1,118 @@
+package twitterintersection
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// the prefix of the accounts given by user id instead of screen name
+const idAccountPrefix = "id:"
+
+// the most screen names twitter resolves per request
+const maxScreenNamesPerLookup = 100
+
+// IdAccount returns the account of the user with the id, "id:" followed by
+// the id.  It is accepted wherever a screen name is and, unlike a screen
+// name, does not change when the user is renamed.
+func IdAccount(id uint64) string {
+	return idAccountPrefix + strconv.FormatUint(id, 10)
+}
+
+// AccountId returns the id of an account of the form "id:12345".  ok is
+// false for a screen name.
+func AccountId(account string) (id uint64, ok bool) {
+	if !strings.HasPrefix(account, idAccountPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(account[len(idAccountPrefix):], 10, 64)
+	return id, err == nil && id != 0
+}
+
+// returns the name of the directory of an account in the stores: the
+// screen name in lower case or, for an IdAccount, "id-" followed by the id
+// since colons are not allowed in the paths of every system
+func accountDir(account string) string {
+	if id, ok := AccountId(account); ok {
+		return "id-" + strconv.FormatUint(id, 10)
+	}
+	return strings.ToLower(account)
+}
+
+// returns the account of the directory name of a store, the reverse of
+// accountDir
+func dirAccount(relation Relation, name string) *AccountExpr {
+	if id, err := strconv.ParseUint(strings.TrimPrefix(name, "id-"), 10, 64); err == nil && strings.HasPrefix(name, "id-") {
+		return &AccountExpr{Relation: relation, Id: id}
+	}
+	return &AccountExpr{Relation: relation, ScreenName: name}
+}
+
+// returns the parameter of the api selecting the account, user_id or
+// screen_name
+func accountParams(account string, params map[string]string) map[string]string {
+	if id, ok := AccountId(account); ok {
+		params["user_id"] = strconv.FormatUint(id, 10)
+	} else {
+		params["screen_name"] = account
+	}
+	return params
+}
+
+// ScreenNameResolver resolves screen names to the stable ids of the users.
+type ScreenNameResolver interface {
+	// ResolveScreenNames returns the ids of the users keyed by their screen
+	// name in lower case.  The screen names of no user are absent.
+	ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error)
+}
+
+// ResolveAccounts sets the Id of the accounts given by screen name with the
+// ids resolved, in as few requests as possible, by resolver.  The accounts
+// that cannot be resolved keep their screen name only.
+func ResolveAccounts(ctx context.Context, resolver ScreenNameResolver, accounts []*AccountExpr) error {
+	screenNames := make([]string, 0, len(accounts))
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		if account.Id == 0 && !seen[account.ScreenName] {
+			seen[account.ScreenName] = true
+			screenNames = append(screenNames, account.ScreenName)
+		}
+	}
+	if len(screenNames) == 0 {
+		return nil
+	}
+	ids, err := resolver.ResolveScreenNames(ctx, screenNames)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if id, ok := ids[strings.ToLower(account.ScreenName)]; ok && account.Id == 0 {
+			account.Id = id
+		}
+	}
+	return nil
+}
+
+// calls lookup with the screen names by batches of the most twitter
+// accepts and returns the ids of all the users found
+func resolveByBatches(screenNames []string, lookup func(batch []string) ([]*User, error)) (map[string]uint64, error) {
+	ids := make(map[string]uint64, len(screenNames))
+	for len(screenNames) > 0 {
+		batch := screenNames
+		if len(batch) > maxScreenNamesPerLookup {
+			batch = batch[:maxScreenNamesPerLookup]
+		}
+		screenNames = screenNames[len(batch):]
+		users, err := lookup(batch)
+		if IsNotFound(err) {
+			// none of the users exist
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			ids[strings.ToLower(user.ScreenName)] = user.Id
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,71 @@
+package twitterintersection
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingResolver resolves the screen names of ids and records the
+// screen names it is asked for
+type recordingResolver struct {
+	ids   map[string]uint64
+	calls [][]string
+}
+
+func (r *recordingResolver) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	r.calls = append(r.calls, screenNames)
+	ids := make(map[string]uint64)
+	for _, name := range screenNames {
+		if id, ok := r.ids[strings.ToLower(name)]; ok {
+			ids[strings.ToLower(name)] = id
+		}
+	}
+	return ids, nil
+}
+
+func TestAccountId(t *testing.T) {
+	if account := IdAccount(1492); account != "id:1492" {
+		t.Error("bad account", account)
+	}
+	if id, ok := AccountId("id:1492"); !ok || id != 1492 {
+		t.Error("bad id", id, ok)
+	}
+	for _, account := range []string{"bob", "id:", "id:0", "id:bob", "ID:12"} {
+		if _, ok := AccountId(account); ok {
+			t.Error(account, "is not an IdAccount")
+		}
+	}
+	if dir := accountDir("id:1492"); dir != "id-1492" || !reflect.DeepEqual(dirAccount(Friends, dir), &AccountExpr{Relation: Friends, Id: 1492}) {
+		t.Error("bad directory", dir)
+	}
+	if dir := accountDir("BobLeChef"); dir != "boblechef" || !reflect.DeepEqual(dirAccount(Followers, dir), &AccountExpr{Relation: Followers, ScreenName: "boblechef"}) {
+		t.Error("bad directory", dir)
+	}
+}
+
+func TestResolveAccounts(t *testing.T) {
+	expr, err := ParseQuery("(alice & friends:Alice) | bob | id:7 | carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &recordingResolver{ids: map[string]uint64{"alice": 1, "bob": 2}}
+	accounts := QueryAccounts(expr)
+	if err := ResolveAccounts(context.Background(), resolver, accounts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resolver.calls, [][]string{{"alice", "bob", "carol"}}) {
+		t.Error("the screen names should be resolved at once", resolver.calls)
+	}
+	resolved := make([]string, len(accounts))
+	for i, account := range accounts {
+		resolved[i] = string(account.Relation) + ":" + account.Account()
+	}
+	if expected := []string{"followers:id:1", "friends:id:1", "followers:id:2", "followers:id:7", "followers:carol"}; !reflect.DeepEqual(resolved, expected) {
+		t.Error("bad accounts", resolved)
+	}
+	if expr.String() != "((((alice & friends:alice) | bob) | id:7) | carol)" {
+		t.Error("the query should keep its screen names", expr)
+	}
+}
@@ -1,17 +1,61 @@
-package main
+package twitterintersection
 
-type idHolder struct {
-	Id uint64 `json:"id"`
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Relation is the kind of link between an account and the users returned
+// about it: its followers or its friends (the accounts it follows).
+type Relation string
+
+const (
+	Followers Relation = "followers"
+	Friends   Relation = "friends"
+)
+
+// returns the relation named s
+func ParseRelation(s string) (Relation, error) {
+	switch r := Relation(strings.ToLower(s)); r {
+	case Followers, Friends:
+		return r, nil
+	}
+	return "", errors.New("unknown relation " + s + ", should be followers or friends")
 }
 
 type User struct {
-	ScreenName string `json:"screen_name"`
-	Id         uint64 `json:"id"`
+	Id             uint64 `json:"id"`
+	ScreenName     string `json:"screen_name"`
+	Name           string `json:"name"`
+	FollowersCount int    `json:"followers_count"`
+	FriendsCount   int    `json:"friends_count"`
+	CreatedAt      string `json:"created_at"`
+	Verified       bool   `json:"verified"`
+	Protected      bool   `json:"protected"`
+	Location       string `json:"location"`
 }
 
+// UserLookup is the result of the lookup of a user id.  User is nil when
+// twitter does not return the user, because it is suspended or deleted, or
+// when the lookup failed with Err.
+type UserLookup struct {
+	Id   uint64
+	User *User
+	Err  error
+}
+
+func (l *UserLookup) Missing() bool {
+	return l.User == nil && l.Err == nil
+}
+
+// FollowerList is a page of users.  Err is set when the page cannot be
+// fetched.
 type FollowerList struct {
 	NextCursor string  `json:"next_cursor_str"`
 	Followers  []*User `json:"users"`
+	Err        error   `json:"-"`
 }
 
 func (f *FollowerList) GetFollowerScreenNames() []string {
@@ -22,20 +66,142 @@ func (f *FollowerList) GetFollowerScreenNames() []string {
 	return ret
 }
 
+// FollowerIDList is a page of user ids.  Err is set when the page cannot be
+// fetched.
 type FollowerIDList struct {
 	NextCursor string   `json:"next_cursor_str"`
 	Followers  []uint64 `json:"ids"`
+	Err        error    `json:"-"`
+}
+
+// the error codes of twitter, see
+// https://developer.twitter.com/en/docs/basics/response-codes
+const (
+	ERR_NO_USER_MATCHES     = 17
+	ERR_AUTHENTICATION      = 32
+	ERR_PAGE_NOT_EXIST      = 34
+	ERR_USER_NOT_FOUND      = 50
+	ERR_USER_SUSPENDED      = 63
+	ERR_RATE_LIMIT_EXCEEDED = 88
+	ERR_INVALID_TOKEN       = 89
+	ERR_OVER_CAPACITY       = 130
+	ERR_INTERNAL_ERROR      = 131
+)
+
+// TwitterErrorCode is one of the errors listed in an error response of
+// twitter.
+type TwitterErrorCode struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
+// TwitterErr is an error response of twitter.  Msg is the body of the
+// response and Errors the errors it lists, if any.
 type TwitterErr struct {
 	Msg    string
 	Status int
+	Errors []TwitterErrorCode
 }
 
 func (err *TwitterErr) Error() string {
-	return err.Msg
+	if len(err.Errors) == 0 {
+		return err.Msg
+	}
+	msgs := make([]string, len(err.Errors))
+	for i, e := range err.Errors {
+		msgs[i] = e.Message + " (code " + strconv.Itoa(e.Code) + ")"
+	}
+	return strings.Join(msgs, ", ")
 }
 
+// HasCode returns true if twitter reported the error code.
+func (err *TwitterErr) HasCode(codes ...int) bool {
+	for _, e := range err.Errors {
+		for _, code := range codes {
+			if e.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns a TwitterErr with the errors listed in msg, the body of a
+// response in the {"errors": [{"code": 50, "message": "..."}]} form
 func NewTwitterErr(msg string, status int) *TwitterErr {
-	return &TwitterErr{msg, status}
+	var body struct {
+		Errors []TwitterErrorCode `json:"errors"`
+	}
+	json.Unmarshal([]byte(msg), &body)
+	return &TwitterErr{msg, status, body.Errors}
+}
+
+// returns the TwitterErr in the chain of err, or nil
+func asTwitterErr(err error) *TwitterErr {
+	var twitterErr *TwitterErr
+	if errors.As(err, &twitterErr) {
+		return twitterErr
+	}
+	return nil
+}
+
+// IsNotFound returns true if err is twitter reporting that the user or the
+// page does not exist.
+func IsNotFound(err error) bool {
+	twitterErr := asTwitterErr(err)
+	if twitterErr == nil {
+		return false
+	} else if len(twitterErr.Errors) == 0 {
+		return twitterErr.Status == 404
+	}
+	return twitterErr.HasCode(ERR_NO_USER_MATCHES, ERR_PAGE_NOT_EXIST, ERR_USER_NOT_FOUND)
+}
+
+// IsSuspended returns true if err is twitter reporting that the user is
+// suspended.
+func IsSuspended(err error) bool {
+	twitterErr := asTwitterErr(err)
+	return twitterErr != nil && twitterErr.HasCode(ERR_USER_SUSPENDED)
+}
+
+// IsRateLimited returns true if err is twitter refusing a request because
+// of its rate limit.
+func IsRateLimited(err error) bool {
+	twitterErr := asTwitterErr(err)
+	return twitterErr != nil && (twitterErr.Status == 429 || twitterErr.HasCode(ERR_RATE_LIMIT_EXCEEDED))
+}
+
+// IsInvalidToken returns true if err is twitter rejecting the credentials
+// of the request.  The other 401 responses, for instance for a protected
+// account, are not caused by the credentials.
+func IsInvalidToken(err error) bool {
+	twitterErr := asTwitterErr(err)
+	return twitterErr != nil && twitterErr.HasCode(ERR_INVALID_TOKEN, ERR_AUTHENTICATION)
+}
+
+// AccountErr is the error met while getting the users in relation with an
+// account.
+type AccountErr struct {
+	ScreenName string
+	Relation   Relation
+	Err        error
+}
+
+func (err *AccountErr) Error() string {
+	reason := err.Err.Error()
+	switch {
+	case IsNotFound(err.Err):
+		reason = "the account does not exist"
+	case IsSuspended(err.Err):
+		reason = "the account is suspended"
+	case IsInvalidToken(err.Err):
+		reason = "the credentials are rejected by twitter"
+	case asTwitterErr(err.Err) != nil && asTwitterErr(err.Err).Status == 401:
+		reason = "the account is protected"
+	}
+	return "cannot get the " + string(err.Relation) + " of " + err.ScreenName + ": " + reason
+}
+
+func (err *AccountErr) Unwrap() error {
+	return err.Err
 }
@@ -1,14 +1,15 @@
-package main
+package twitterintersection
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 )
 
 func TestUserJsonification(t *testing.T) {
 	jsonForm := `{"screen_name": "boblechef", "id": 2920819021}`
-	expectedUser := &User{"boblechef", 2920819021}
+	expectedUser := &User{ScreenName: "boblechef", Id: 2920819021}
 	u := new(User)
 	if err := json.Unmarshal([]byte(jsonForm), u); err != nil {
 		t.Error(err)
@@ -17,9 +18,22 @@ func TestUserJsonification(t *testing.T) {
 	}
 }
 
+func TestUserJsonificationWithMetadata(t *testing.T) {
+	jsonForm := `{"id": 6253282, "screen_name": "twitterapi", "name": "Twitter API", "followers_count": 6133636,
+		"friends_count": 12, "created_at": "Wed May 23 06:01:13 +0000 2007", "verified": true, "protected": false,
+		"location": "San Francisco, CA", "statuses_count": 3656}`
+	expectedUser := &User{6253282, "twitterapi", "Twitter API", 6133636, 12, "Wed May 23 06:01:13 +0000 2007", true, false, "San Francisco, CA"}
+	u := new(User)
+	if err := json.Unmarshal([]byte(jsonForm), u); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(u, expectedUser) {
+		t.Error(u)
+	}
+}
+
 func TestFollowerListJsonification(t *testing.T) {
 	jsonForm := `{"next_cursor_str": "3333", "users":[ {"screen_name": "boblechef", "id": 2920819021}]}`
-	expectedUserList := &FollowerList{"3333", []*User{&User{"boblechef", 2920819021}}}
+	expectedUserList := &FollowerList{NextCursor: "3333", Followers: []*User{&User{ScreenName: "boblechef", Id: 2920819021}}}
 	l := new(FollowerList)
 	if err := json.Unmarshal([]byte(jsonForm), l); err != nil {
 		t.Error(err)
@@ -27,3 +41,74 @@ func TestFollowerListJsonification(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestParseRelation(t *testing.T) {
+	if r, err := ParseRelation("Friends"); err != nil || r != Friends {
+		t.Error(r, err)
+	}
+	if r, err := ParseRelation("followers"); err != nil || r != Followers {
+		t.Error(r, err)
+	}
+	if _, err := ParseRelation("enemies"); err == nil {
+		t.Error("enemies is not a relation")
+	}
+}
+
+func TestNewTwitterErr(t *testing.T) {
+	err := NewTwitterErr(`{"errors":[{"code":50,"message":"User not found."},{"code":63,"message":"User has been suspended."}]}`, 404)
+	expected := []TwitterErrorCode{{50, "User not found."}, {63, "User has been suspended."}}
+	if !reflect.DeepEqual(err.Errors, expected) {
+		t.Error("bad errors", err.Errors)
+	}
+	if err.Error() != "User not found. (code 50), User has been suspended. (code 63)" {
+		t.Error("bad message", err)
+	}
+	if err := NewTwitterErr("<html>Over capacity</html>", 503); len(err.Errors) != 0 || err.Error() != "<html>Over capacity</html>" {
+		t.Error("the body should be the message", err)
+	}
+}
+
+func TestTwitterErrChecks(t *testing.T) {
+	notFound := NewTwitterErr(`{"errors":[{"code":50,"message":"User not found."}]}`, 404)
+	suspended := NewTwitterErr(`{"errors":[{"code":63,"message":"User has been suspended."}]}`, 403)
+	rateLimited := NewTwitterErr(`{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`, 429)
+	invalidToken := NewTwitterErr(`{"errors":[{"code":89,"message":"Invalid or expired token."}]}`, 401)
+	protected := NewTwitterErr(`{"request":"/1.1/followers/ids.json","error":"Not authorized."}`, 401)
+
+	checks := []struct {
+		check    func(error) bool
+		expected error
+	}{
+		{IsNotFound, notFound},
+		{IsSuspended, suspended},
+		{IsRateLimited, rateLimited},
+		{IsInvalidToken, invalidToken},
+	}
+	for i, c := range checks {
+		for _, err := range []error{notFound, suspended, rateLimited, invalidToken, protected} {
+			if c.check(err) != (err == c.expected) {
+				t.Error("bad check", i, err)
+			}
+		}
+	}
+	if !IsNotFound(&AccountErr{"bob", Followers, notFound}) {
+		t.Error("the wrapped errors should be checked")
+	}
+	if !IsNotFound(NewTwitterErr("", 404)) || IsNotFound(errors.New("boom")) {
+		t.Error("a 404 without code is not found")
+	}
+}
+
+func TestAccountErrMessagesOfTwitterCodes(t *testing.T) {
+	errs := map[string]error{
+		"cannot get the followers of bob: the account does not exist":              NewTwitterErr(`{"errors":[{"code":34,"message":"Sorry, that page does not exist."}]}`, 404),
+		"cannot get the followers of bob: the account is suspended":                NewTwitterErr(`{"errors":[{"code":63,"message":"User has been suspended."}]}`, 403),
+		"cannot get the followers of bob: the account is protected":                NewTwitterErr(`{"error":"Not authorized."}`, 401),
+		"cannot get the followers of bob: the credentials are rejected by twitter": NewTwitterErr(`{"errors":[{"code":89,"message":"Invalid or expired token."}]}`, 401),
+	}
+	for expected, err := range errs {
+		if msg := (&AccountErr{"bob", Followers, err}).Error(); msg != expected {
+			t.Error("expected", expected, "but received", msg)
+		}
+	}
+}
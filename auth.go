@@ -0,0 +1,166 @@
+package twitterintersection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const TWITTER_OAUTH2_URL = "https://api.twitter.com/oauth2"
+
+// the file, in the home directory, where the credentials are read when they
+// are not given otherwise
+const DEFAULT_CREDENTIALS_FILE = ".twitterintersection.json"
+
+// Credentials are the consumer key and secret of a twitter application and,
+// optionally, the access token of a user of the application.
+type Credentials struct {
+	ConsumerKey       string `json:"consumer_key"`
+	ConsumerSecret    string `json:"consumer_secret"`
+	AccessToken       string `json:"access_token"`
+	AccessTokenSecret string `json:"access_token_secret"`
+}
+
+// returns true if the credentials allow to authenticate in the context of a
+// user
+func (c *Credentials) HasUserContext() bool {
+	return c.AccessToken != "" && c.AccessTokenSecret != ""
+}
+
+type bearerToken struct {
+	TokenType   string `json:"token_type"`
+	AccessToken string `json:"access_token"`
+}
+
+// returns the default path of the credentials file
+func DefaultCredentialsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, DEFAULT_CREDENTIALS_FILE)
+}
+
+// reads a json file holding either one credentials object or a list of them
+func readCredentialsFile(path string) ([]*Credentials, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	credentials := make([]*Credentials, 0)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &credentials)
+	} else {
+		credentials = append(credentials, new(Credentials))
+		err = json.Unmarshal(data, credentials[0])
+	}
+	if err != nil {
+		return nil, errors.New("cannot read credentials file " + path + ": " + err.Error())
+	}
+	return credentials, nil
+}
+
+// LoadCredentials returns the credentials of the application.  The json
+// file at configPath can hold one credentials object or a list of them, one
+// per token of a TokenPool.  The values of the first credentials are taken
+// from flags when not empty, otherwise from the TWITTER_CONSUMER_KEY,
+// TWITTER_CONSUMER_SECRET, TWITTER_ACCESS_TOKEN and TWITTER_ACCESS_TOKEN_SECRET
+// environment variables, otherwise from the file.  A missing file is not an
+// error.
+func LoadCredentials(flags *Credentials, configPath string) ([]*Credentials, error) {
+	list, err := readCredentialsFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		list = append(list, new(Credentials))
+	}
+	credentials := list[0]
+	for _, v := range []struct {
+		dest      *string
+		flag, env string
+	}{
+		{&credentials.ConsumerKey, flags.ConsumerKey, "TWITTER_CONSUMER_KEY"},
+		{&credentials.ConsumerSecret, flags.ConsumerSecret, "TWITTER_CONSUMER_SECRET"},
+		{&credentials.AccessToken, flags.AccessToken, "TWITTER_ACCESS_TOKEN"},
+		{&credentials.AccessTokenSecret, flags.AccessTokenSecret, "TWITTER_ACCESS_TOKEN_SECRET"},
+	} {
+		if v.flag != "" {
+			*v.dest = v.flag
+		} else if env := os.Getenv(v.env); env != "" {
+			*v.dest = env
+		}
+	}
+	for _, c := range list {
+		if c.ConsumerKey == "" || c.ConsumerSecret == "" {
+			return nil, errors.New("missing consumer key or consumer secret")
+		}
+	}
+	return list, nil
+}
+
+func postOAuth2(ctx context.Context, oauthUrl, endpoint string, credentials *Credentials, params url.Values, opts []Option) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", oauthUrl+endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	encodedCredentials := new(TwitterApi).GetBase64EncodedBearerTokenCredentials(credentials.ConsumerKey, credentials.ConsumerSecret)
+	req.Header.Set("Authorization", "Basic "+encodedCredentials)
+	req.Header.Set("content-type", "application/x-www-form-urlencoded;charset=UTF-8")
+	o := newOptions(opts)
+	if o.userAgent != "" {
+		req.Header.Set("User-Agent", o.userAgent)
+	}
+	resp, err := o.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		if errMsg, err := ioutil.ReadAll(resp.Body); err != nil {
+			return nil, errors.New("error posting to " + endpoint + " and cannot deserialize error message")
+		} else {
+			return nil, NewTwitterErr(string(errMsg), resp.StatusCode)
+		}
+	}
+	return resp, nil
+}
+
+// RequestBearerToken obtains an application-only bearer token from the
+// token endpoint of oauthUrl.
+func RequestBearerToken(ctx context.Context, oauthUrl string, credentials *Credentials, opts ...Option) (string, error) {
+	params := url.Values{"grant_type": {"client_credentials"}}
+	resp, err := postOAuth2(ctx, oauthUrl, "/token", credentials, params, opts)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	token := new(bearerToken)
+	if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return "", err
+	} else if token.TokenType != "bearer" || token.AccessToken == "" {
+		return "", errors.New("unexpected token type " + token.TokenType)
+	}
+	return token.AccessToken, nil
+}
+
+// InvalidateBearerToken revokes a bearer token previously obtained with
+// RequestBearerToken.
+func InvalidateBearerToken(ctx context.Context, oauthUrl string, credentials *Credentials, accessToken string, opts ...Option) error {
+	params := url.Values{"access_token": {accessToken}}
+	resp, err := postOAuth2(ctx, oauthUrl, "/invalidate_token", credentials, params, opts)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
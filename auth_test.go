@@ -0,0 +1,126 @@
+package twitterintersection
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, []byte(`{"consumer_key": "file_key", "consumer_secret": "file_secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TWITTER_CONSUMER_KEY", "")
+	os.Setenv("TWITTER_CONSUMER_SECRET", "env_secret")
+	defer os.Unsetenv("TWITTER_CONSUMER_KEY")
+	defer os.Unsetenv("TWITTER_CONSUMER_SECRET")
+
+	if l, err := LoadCredentials(new(Credentials), path); err != nil {
+		t.Error(err)
+	} else if c := l[0]; len(l) != 1 || c.ConsumerKey != "file_key" || c.ConsumerSecret != "env_secret" {
+		t.Error("bad credentials", c)
+	}
+
+	if l, err := LoadCredentials(&Credentials{ConsumerKey: "flag_key", ConsumerSecret: "flag_secret"}, path); err != nil {
+		t.Error(err)
+	} else if c := l[0]; c.ConsumerKey != "flag_key" || c.ConsumerSecret != "flag_secret" {
+		t.Error("bad credentials", c)
+	} else if c.HasUserContext() {
+		t.Error("there is no access token")
+	}
+
+	if _, err := LoadCredentials(new(Credentials), filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("the consumer key is missing")
+	}
+}
+
+func TestLoadCredentialsList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	content := `[{"consumer_key": "key1", "consumer_secret": "secret1"}, {"consumer_key": "key2", "consumer_secret": "secret2"}]`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err := LoadCredentials(new(Credentials), path); err != nil {
+		t.Error(err)
+	} else if len(l) != 2 || l[0].ConsumerKey != "key1" || l[1].ConsumerSecret != "secret2" {
+		t.Error("bad credentials", l)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`[{"consumer_key": "key1"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCredentials(new(Credentials), path); err == nil {
+		t.Error("the consumer secret is missing")
+	}
+}
+
+func TestRequestBearerToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/token" {
+			t.Error("bad request", r.Method, r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Basic eHZ6MWV2RlM0d0VFUFRHRUZQSEJvZzpMOHFxOVBaeVJnNmllS0dFS2hab2xHQzB2SldMdzhpRUo4OERSZHlPZw==" {
+			t.Error("bad authorization in header :", auth)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "grant_type=client_credentials" {
+			t.Error("bad body", string(body))
+		}
+		fmt.Fprint(w, `{"token_type":"bearer","access_token":"AAAA%2FAAA%3DAAAAAAAA"}`)
+	}))
+	defer ts.Close()
+	credentials := &Credentials{ConsumerKey: "xvz1evFS4wEEPTGEFPHBog", ConsumerSecret: "L8qq9PZyRg6ieKGEKhZolGC0vJWLw8iEJ88DRdyOg"}
+
+	if token, err := RequestBearerToken(context.Background(), ts.URL, credentials); err != nil {
+		t.Error(err)
+	} else if token != "AAAA%2FAAA%3DAAAAAAAA" {
+		t.Error("bad token", token)
+	}
+}
+
+func TestRequestBearerTokenError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+		fmt.Fprint(w, `{"errors":[{"code":99,"message":"Unable to verify your credentials"}]}`)
+	}))
+	defer ts.Close()
+
+	if _, err := RequestBearerToken(context.Background(), ts.URL, &Credentials{ConsumerKey: "key", ConsumerSecret: "secret"}); err == nil {
+		t.Error("should have an error here")
+	} else if terr, ok := err.(*TwitterErr); !ok || terr.Status != 403 {
+		t.Error("bad error", err)
+	}
+}
+
+func TestInvalidateBearerToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/invalidate_token" {
+			t.Error("bad request", r.Method, r.URL)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "access_token=AAAA%252FAAA%253DAAAAAAAA" {
+			t.Error("bad body", string(body))
+		}
+		fmt.Fprint(w, `{"access_token":"AAAA%2FAAA%3DAAAAAAAA"}`)
+	}))
+	defer ts.Close()
+
+	if err := InvalidateBearerToken(context.Background(), ts.URL, &Credentials{ConsumerKey: "key", ConsumerSecret: "secret"}, "AAAA%2FAAA%3DAAAAAAAA"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,205 @@
+package twitterintersection
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Checkpoint is the progress of the crawl of the users in relation with an
+// account: the ids collected so far and the cursor of the next page.
+type Checkpoint struct {
+	NextCursor string
+	Ids        []uint64
+}
+
+// the content of the cursor file of a checkpoint.  IdsSize is the size of
+// the ids file once the ids of the pages before NextCursor are written, what
+// is after comes from an interrupted write.
+type checkpointCursor struct {
+	NextCursor string `json:"next_cursor"`
+	IdsSize    int64  `json:"ids_size"`
+}
+
+// CheckpointStore persists the progress of crawls in a directory.  Each
+// account has a directory holding an "ids" file, with one id per line, and a
+// "cursor" file.
+type CheckpointStore struct {
+	Dir string
+}
+
+func NewCheckpointStore(dir string) *CheckpointStore {
+	return &CheckpointStore{dir}
+}
+
+func (s *CheckpointStore) dir(relation Relation, screenName string) string {
+	return filepath.Join(s.Dir, string(relation), accountDir(screenName))
+}
+
+func (s *CheckpointStore) readCursor(dir string) (*checkpointCursor, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cursor"))
+	if err != nil {
+		return nil, err
+	}
+	cursor := new(checkpointCursor)
+	return cursor, json.Unmarshal(data, cursor)
+}
+
+// Load returns the checkpoint of the crawl of the users in relation with
+// screenName or nil if there is none.
+func (s *CheckpointStore) Load(relation Relation, screenName string) (*Checkpoint, error) {
+	dir := s.dir(relation, screenName)
+	cursor, err := s.readCursor(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, "ids"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	checkpoint := &Checkpoint{cursor.NextCursor, make([]uint64, 0)}
+	scanner := bufio.NewScanner(io.LimitReader(f, cursor.IdsSize))
+	for scanner.Scan() {
+		id, err := strconv.ParseUint(scanner.Text(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		checkpoint.Ids = append(checkpoint.Ids, id)
+	}
+	return checkpoint, scanner.Err()
+}
+
+// Append adds a page of ids to the checkpoint of the crawl of the users in
+// relation with screenName.  The checkpoint is removed once the last page is
+// received, a complete crawl is kept by the snapshots.
+func (s *CheckpointStore) Append(relation Relation, screenName string, page *FollowerIDList) error {
+	if page.NextCursor == "0" || page.NextCursor == "" {
+		return s.Reset(relation, screenName)
+	}
+	dir := s.dir(relation, screenName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cursor, err := s.readCursor(dir)
+	if os.IsNotExist(err) {
+		cursor = new(checkpointCursor)
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "ids"), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(cursor.IdsSize); err != nil {
+		return err
+	} else if _, err := f.Seek(cursor.IdsSize, io.SeekStart); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, id := range page.Followers {
+		w.WriteString(strconv.FormatUint(id, 10))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if cursor.IdsSize, err = f.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	cursor.NextCursor = page.NextCursor
+	return writeFileAtomically(filepath.Join(dir, "cursor"), cursor)
+}
+
+// Reset removes the checkpoint of the crawl of the users in relation with
+// screenName.
+func (s *CheckpointStore) Reset(relation Relation, screenName string) error {
+	return os.RemoveAll(s.dir(relation, screenName))
+}
+
+// writes v as json in a temporary file then moves it at path, so path is
+// never left half written.
+func writeFileAtomically(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// CheckpointingGetter is a FollowerGetter that records every page of ids it
+// receives in a CheckpointStore.  When Resume is true, a crawl starts back
+// from its checkpoint instead of from the first page.
+type CheckpointingGetter struct {
+	FollowerGetter
+	Store  *CheckpointStore
+	Resume bool
+}
+
+func NewCheckpointingGetter(followerGetter FollowerGetter, store *CheckpointStore, resume bool) *CheckpointingGetter {
+	return &CheckpointingGetter{followerGetter, store, resume}
+}
+
+// ResolveScreenNames resolves the screen names with the FollowerGetter, or
+// resolves none when it is not a ScreenNameResolver.
+func (g *CheckpointingGetter) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	if resolver, ok := g.FollowerGetter.(ScreenNameResolver); ok {
+		return resolver.ResolveScreenNames(ctx, screenNames)
+	}
+	return make(map[string]uint64), nil
+}
+
+func (g *CheckpointingGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	followerListC := make(chan *FollowerIDList)
+	go func() {
+		if cursor == "-1" {
+			if page := g.start(relation, screenName); page != nil {
+				followerListC <- page
+				return
+			}
+		}
+		page := <-g.FollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)
+		if page.Err == nil {
+			if err := g.Store.Append(relation, screenName, page); err != nil {
+				log.Println("cannot save the checkpoint of", screenName, ":", err)
+			}
+		}
+		followerListC <- page
+	}()
+	return followerListC
+}
+
+// returns the ids collected so far by the crawl of the account, as a page
+// whose next cursor is the one of the checkpoint, when resuming.  Otherwise
+// the checkpoint is discarded and nil is returned.
+func (g *CheckpointingGetter) start(relation Relation, screenName string) *FollowerIDList {
+	if g.Resume {
+		if checkpoint, err := g.Store.Load(relation, screenName); err != nil {
+			log.Println("cannot read the checkpoint of", screenName, ":", err)
+		} else if checkpoint != nil {
+			log.Printf("resuming %v of %v with %v ids at cursor %v", relation, screenName, len(checkpoint.Ids), checkpoint.NextCursor)
+			return &FollowerIDList{NextCursor: checkpoint.NextCursor, Followers: checkpoint.Ids}
+		}
+	}
+	if err := g.Store.Reset(relation, screenName); err != nil {
+		log.Println("cannot reset the checkpoint of", screenName, ":", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestCheckpointStore(t *testing.T) *CheckpointStore {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCheckpointStore(dir)
+}
+
+func TestCheckpointStore(t *testing.T) {
+	s := newTestCheckpointStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	if c, err := s.Load(Followers, "bobLeChef"); err != nil || c != nil {
+		t.Error("there should be no checkpoint", c, err)
+	}
+	if err := s.Append(Followers, "bobLeChef", &FollowerIDList{NextCursor: "12", Followers: []uint64{1, 2}}); err != nil {
+		t.Error(err)
+	}
+	if err := s.Append(Followers, "BobLeChef", &FollowerIDList{NextCursor: "13", Followers: []uint64{3}}); err != nil {
+		t.Error(err)
+	}
+	if c, err := s.Load(Followers, "bobLeChef"); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(c, &Checkpoint{"13", []uint64{1, 2, 3}}) {
+		t.Error("bad checkpoint", c)
+	}
+	if c, _ := s.Load(Friends, "bobLeChef"); c != nil {
+		t.Error("the checkpoints of the relations are independent")
+	}
+
+	// ids written after the last cursor come from an interrupted write
+	f, _ := os.OpenFile(filepath.Join(s.Dir, "followers", "boblechef", "ids"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("4\n5")
+	f.Close()
+	if c, _ := s.Load(Followers, "bobLeChef"); !reflect.DeepEqual(c, &Checkpoint{"13", []uint64{1, 2, 3}}) {
+		t.Error("bad checkpoint after an interrupted write", c)
+	}
+	if err := s.Append(Followers, "bobLeChef", &FollowerIDList{NextCursor: "14", Followers: []uint64{6}}); err != nil {
+		t.Error(err)
+	}
+	if c, _ := s.Load(Followers, "bobLeChef"); !reflect.DeepEqual(c, &Checkpoint{"14", []uint64{1, 2, 3, 6}}) {
+		t.Error("bad checkpoint", c)
+	}
+	if err := s.Append(Followers, "bobLeChef", &FollowerIDList{NextCursor: "0", Followers: []uint64{7}}); err != nil {
+		t.Error(err)
+	}
+	if c, _ := s.Load(Followers, "bobLeChef"); c != nil {
+		t.Error("the checkpoint of a complete crawl should be removed", c)
+	}
+
+	s.Append(Followers, "bobLeChef", &FollowerIDList{NextCursor: "12", Followers: []uint64{1, 2}})
+	if err := s.Reset(Followers, "bobLeChef"); err != nil {
+		t.Error(err)
+	}
+	if c, _ := s.Load(Followers, "bobLeChef"); c != nil {
+		t.Error("the checkpoint should be removed")
+	}
+}
+
+// fails the test when a page is requested
+type failingFollowerGetter struct {
+	MockFollowerGetter
+}
+
+func (m *failingFollowerGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	m.T.Error("should not fetch the cursor", cursor)
+	followerListC := make(chan *FollowerIDList, 1)
+	followerListC <- &FollowerIDList{Err: errors.New("unexpected fetch")}
+	return followerListC
+}
+
+func TestCheckpointingGetter(t *testing.T) {
+	s := newTestCheckpointStore(t)
+	defer os.RemoveAll(s.Dir)
+	s.Append(Followers, "justinBieber", &FollowerIDList{NextCursor: "33", Followers: []uint64{7, 8}})
+
+	fg := NewCheckpointingGetter(&MockFollowerGetter{t}, s, false)
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), fg, "justinBieber")); !reflect.DeepEqual(ids, []uint64{1, 2, 3, 4}) {
+		t.Error("bad ids", ids)
+	}
+	if c, _ := s.Load(Followers, "justinBieber"); c != nil {
+		t.Error("the checkpoint of a complete crawl should be removed", c)
+	}
+
+	s.Append(Followers, "justinBieber", &FollowerIDList{NextCursor: "1", Followers: []uint64{1, 2}})
+	fg = NewCheckpointingGetter(&MockFollowerGetter{t}, s, true)
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), fg, "justinBieber")); !reflect.DeepEqual(ids, []uint64{1, 2, 3, 4}) {
+		t.Error("bad ids after resume", ids)
+	}
+	if c, _ := s.Load(Followers, "justinBieber"); c != nil {
+		t.Error("the checkpoint of a resumed crawl should be removed once complete", c)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+var authCommand = &command{"auth", "",
+	"check that twitter accepts the credentials and print the requests left on /followers/ids for each of them",
+	setupAuth}
+
+// the rate limits of an endpoint, as returned by application/rate_limit_status
+type rateLimitStatus struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
+func setupAuth(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	invalidate := fs.Bool("invalidate", false, "invalidate the bearer tokens of the applications instead")
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 0 {
+			return usageError("auth takes no arguments")
+		}
+		credentials, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+		opts, err := httpOptions()
+		if err != nil {
+			return err
+		}
+		if *invalidate {
+			return invalidateTokens(ctx, credentials, opts)
+		}
+		failed := false
+		for i, c := range credentials {
+			kind := "bearer token"
+			if c.HasUserContext() {
+				kind = "user context"
+			}
+			// the api of every credentials is built apart so that a token
+			// refused does not hide the other credentials
+			api, err := twitterintersection.NewTwitterApiFromCredentials(ctx, c, opts...)
+			if err != nil {
+				fmt.Printf("credentials %v, %v: rejected: %v\n", i+1, kind, err)
+				failed = true
+				continue
+			}
+			status := struct {
+				Resources map[string]map[string]*rateLimitStatus `json:"resources"`
+			}{}
+			params := map[string]string{"resources": "followers"}
+			if err := api.GetAndDeserialize(ctx, "/application/rate_limit_status.json", params, &status); err != nil {
+				fmt.Printf("credentials %v, %v: rejected: %v\n", i+1, kind, err)
+				failed = true
+			} else if limit := status.Resources["followers"]["/followers/ids"]; limit != nil {
+				fmt.Printf("credentials %v, %v: %v of %v requests left until %v\n", i+1, kind, limit.Remaining, limit.Limit, time.Unix(limit.Reset, 0).Format(time.Kitchen))
+			} else {
+				fmt.Printf("credentials %v, %v: accepted\n", i+1, kind)
+			}
+		}
+		if failed {
+			return errors.New("twitter rejects some of the credentials")
+		}
+		return nil
+	}
+}
+
+func invalidateTokens(ctx context.Context, credentials []*twitterintersection.Credentials, opts []twitterintersection.Option) error {
+	var lastErr error
+	for i, c := range credentials {
+		if c.HasUserContext() {
+			fmt.Printf("credentials %v: there is no bearer token to invalidate in the user context\n", i+1)
+			continue
+		}
+		api, err := twitterintersection.NewTwitterApiFromCredentials(ctx, c, opts...)
+		if err != nil {
+			lastErr = err
+		} else if err := twitterintersection.InvalidateBearerToken(ctx, oauth2Url, c, api.AccessToken, opts...); err != nil {
+			lastErr = fmt.Errorf("cannot invalidate the bearer token: %w", err)
+		} else {
+			fmt.Printf("credentials %v: bearer token invalidated\n", i+1)
+		}
+	}
+	return lastErr
+}
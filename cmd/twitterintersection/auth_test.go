@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthReportsEveryCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2/token" {
+			if key, _, _ := r.BasicAuth(); key == "refused" {
+				http.Error(w, `{"errors":[{"code":99,"message":"Unable to verify your credentials"}]}`, http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"token_type":"bearer","access_token":"token"}`)
+			return
+		}
+		fmt.Fprint(w, `{"resources":{"followers":{"/followers/ids":{"limit":15,"remaining":14,"reset":0}}}}`)
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	credentials := `[{"consumer_key": "refused", "consumer_secret": "secret"}, {"consumer_key": "key", "consumer_secret": "secret"}]`
+	if err := os.WriteFile(path, []byte(credentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runArgs(t, "auth", "-base-url", ts.URL, "-oauth2-url", ts.URL+"/oauth2", "-credentials", path)
+	if exitCode(err) != exitFailure {
+		t.Error("the refused credentials should fail the command", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "credentials 1, bearer token: rejected:") || !strings.HasPrefix(lines[1], "credentials 2, bearer token: 14 of 15 requests left") {
+		t.Error("every credentials should be reported", output)
+	}
+}
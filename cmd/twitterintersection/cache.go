@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+var cacheCommand = &command{"cache", "list | clear account... | prune",
+	"list the snapshots of the accounts, remove the snapshots and checkpoint of accounts or remove all but the newest snapshots of every account",
+	setupCache}
+
+func setupCache(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addStoreFlags(fs)
+	keep := fs.Int("keep", 1, "number of snapshots of every account kept by prune")
+	return func(ctx context.Context, args []string) error {
+		if cacheDir == "" {
+			return usageError("the cache needs a directory")
+		}
+		store := twitterintersection.NewSnapshotStore(cacheDir)
+		switch {
+		case len(args) == 1 && args[0] == "list":
+			return listSnapshots(store)
+		case len(args) > 1 && args[0] == "clear":
+			return clearAccounts(ctx, store, args[1:])
+		case len(args) == 1 && args[0] == "prune":
+			if *keep < 0 {
+				return usageError("-keep cannot be negative")
+			}
+			return pruneSnapshots(store, *keep)
+		}
+		return usageError("expected list, clear followed by accounts or prune")
+	}
+}
+
+// prints the number of snapshots of every account and the time of the
+// newest one
+func listSnapshots(store *twitterintersection.SnapshotStore) error {
+	accounts, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, account := range accounts {
+		times, err := store.List(account.Relation, account.Account())
+		if err != nil {
+			return err
+		} else if len(times) > 0 {
+			fmt.Fprintf(w, "%v\t%v snapshots\tnewest %v\n", account, len(times), times[len(times)-1].Format(time.RFC3339))
+		}
+	}
+	return w.Flush()
+}
+
+// removes every snapshot and the checkpoint of the accounts, under their
+// screen names and under the ids recorded for them
+func clearAccounts(ctx context.Context, store *twitterintersection.SnapshotStore, operands []string) error {
+	accounts := make([]*twitterintersection.AccountExpr, len(operands))
+	for i, operand := range operands {
+		account, err := twitterintersection.ParseAccount(operand)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		accounts[i] = account
+	}
+	if err := twitterintersection.ResolveAccounts(ctx, store, accounts); err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		keys := []string{account.Account()}
+		if account.Id != 0 && account.ScreenName != "" {
+			keys = append(keys, account.ScreenName)
+		}
+		removed := 0
+		for _, key := range keys {
+			times, err := store.List(account.Relation, key)
+			if err != nil {
+				return err
+			}
+			for _, t := range times {
+				if err := store.Remove(account.Relation, key, t); err != nil {
+					return err
+				}
+				removed++
+			}
+			if checkpointDir != "" {
+				if err := twitterintersection.NewCheckpointStore(checkpointDir).Reset(account.Relation, key); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Printf("%v: %v snapshots removed\n", account, removed)
+	}
+	return nil
+}
+
+// removes all the snapshots of every account but the keep newest ones
+func pruneSnapshots(store *twitterintersection.SnapshotStore, keep int) error {
+	accounts, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, account := range accounts {
+		times, err := store.List(account.Relation, account.Account())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(times)-keep; i++ {
+			if err := store.Remove(account.Relation, account.Account(), times[i]); err != nil {
+				return err
+			}
+			removed++
+		}
+	}
+	fmt.Printf("%v snapshots removed\n", removed)
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+func TestCacheCommand(t *testing.T) {
+	dir := newTestCacheDir(t)
+	output, err := runArgs(t, "cache", "-cache-dir", dir, "list")
+	if err != nil || strings.Count(output, "\n") != 3 || !strings.Contains(output, "alice  2 snapshots") {
+		t.Error("bad list", output, err)
+	}
+	if output, err := runArgs(t, "cache", "-cache-dir", dir, "prune"); err != nil || output != "1 snapshots removed\n" {
+		t.Error("bad prune", output, err)
+	}
+	if output, err := runArgs(t, "cache", "-cache-dir", dir, "-checkpoint-dir", t.TempDir(), "clear", "bob", "carol"); err != nil || !strings.Contains(output, "carol: 1 snapshots removed") {
+		t.Error("bad clear", output, err)
+	}
+	store := twitterintersection.NewSnapshotStore(dir)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		times, _ := store.List(twitterintersection.Followers, name)
+		if expected := map[string]int{"alice": 1}[name]; len(times) != expected {
+			t.Error("bad snapshots of", name, times)
+		}
+	}
+}
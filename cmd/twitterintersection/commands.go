@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// the exit codes of the program
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// the error of a command stopped by ctrl-c
+var errInterrupted = errors.New("interrupted")
+
+// usageErr is the error of a command called with bad flags or arguments.
+type usageErr struct {
+	msg string
+}
+
+func (err *usageErr) Error() string {
+	return err.msg
+}
+
+func usageError(msg string) error {
+	return &usageErr{msg}
+}
+
+// returns the exit code of the program when it stops with err
+func exitCode(err error) int {
+	var usage *usageErr
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case err == errInterrupted:
+		return exitInterrupted
+	}
+	return exitFailure
+}
+
+// command is a subcommand of the program.
+type command struct {
+	name string
+	// the arguments of the command in its usage line
+	args    string
+	summary string
+	// registers the flags of the command on fs and returns the function
+	// running the command with the arguments left after the flags
+	setup func(fs *flag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+// the commands of the program, in the order of the help
+var commands []*command
+
+func init() {
+	commands = []*command{
+		intersectCommand,
+		unionCommand,
+		queryCommand,
+		statsCommand,
+		diffCommand,
+		idsCommand,
+		lookupCommand,
+		authCommand,
+		cacheCommand,
+		{"help", "[command]", "print the help of the program or of a command", setupHelp},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// returns the flag set of the command, its usage printing the help of the
+// command
+func (c *command) flagSet() (*flag.FlagSet, func(ctx context.Context, args []string) error) {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	run := c.setup(fs)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		// the flags not given can be read from the configuration
+		addConfigFlags(fs)
+	}
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "usage: twitterintersection %v [flags] %v\n\n%v.\n", c.name, c.args, strings.ToUpper(c.summary[:1])+c.summary[1:])
+		if hasFlags {
+			fmt.Fprintf(w, "\nflags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs, run
+}
+
+// runs the command with its arguments, flags included.  The flags given
+// neither before nor after the name of the command are read from the
+// environment or the configuration file.  The timeout starts once the flags
+// are parsed.
+func (c *command) run(ctx context.Context, args []string) error {
+	fs, run := c.flagSet()
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		// the flag set already printed the error and the usage
+		return usageError("")
+	}
+	set := make(map[string]bool)
+	flag.CommandLine.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if err := applyConfig(fs, set); err != nil {
+		return c.usageOrErr(fs, err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return c.usageOrErr(fs, run(ctx, fs.Args()))
+}
+
+// prints the message of a usage error, with a hint toward the help of the
+// command, and returns err
+func (c *command) usageOrErr(fs *flag.FlagSet, err error) error {
+	var usage *usageErr
+	if errors.As(err, &usage) && usage.msg != "" {
+		fmt.Fprintf(fs.Output(), "%v\nrun \"twitterintersection help %v\" for the usage of the command\n", usage.msg, c.name)
+		return usageError("")
+	}
+	return err
+}
+
+// runs the command named by the first argument.  Without command, the
+// arguments are intersected.  A command stopped by the cancellation of ctx
+// returns errInterrupted.
+func runCommand(ctx context.Context, args []string) (err error) {
+	defer func() {
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			err = errInterrupted
+		}
+	}()
+	if len(args) == 0 {
+		printUsage()
+		return usageError("")
+	}
+	if c := findCommand(args[0]); c != nil {
+		return c.run(ctx, args[1:])
+	}
+	return intersectCommand.run(ctx, args)
+}
+
+// prints the help of the program
+func printUsage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: twitterintersection [flags] command [command flags] [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10v %v\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, `
+Without command, the arguments are intersected as with the intersect command.
+Run "twitterintersection help command" for the flags of a command.
+
+The program exits with 0 on success, 1 on failure, 2 when the command line is
+wrong and 130 when interrupted.
+
+flags, that can also be given after the command:
+`)
+	flag.PrintDefaults()
+}
+
+func setupHelp(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			flag.CommandLine.SetOutput(os.Stdout)
+			printUsage()
+			return nil
+		} else if len(args) > 1 {
+			return usageError("help takes a single command")
+		}
+		c := findCommand(args[0])
+		if c == nil {
+			return usageError("unknown command " + args[0])
+		}
+		commandFs, _ := c.flagSet()
+		commandFs.SetOutput(os.Stdout)
+		commandFs.Usage()
+		return nil
+	}
+}
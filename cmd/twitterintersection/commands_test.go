@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+func TestMain(m *testing.M) {
+	// the configuration of the user running the tests is ignored
+	configPath = ""
+	os.Exit(m.Run())
+}
+
+// the variables of the shared flags, restored after every command run by
+// the tests
+var flagVars = []interface{}{&consumerKey, &consumerSecret, &accessToken, &accessTokenSecret, &credentialsPath, &timeout,
+	&requestTimeout, &proxy, &maxAttempts, &apiUrl, &oauth2Url, &idsPageSize, &usersPageSize, &rateLimitMaxWait,
+	&checkpointDir, &resume, &cacheDir, &cacheTTL, &offline, &spillDir, &spillRunSize, &configPath, &profile}
+
+// runs the command line args and returns what it prints on the standard
+// output.  The shared flags are restored afterward.
+func runArgs(t *testing.T, args ...string) (string, error) {
+	return runArgsContext(t, context.Background(), args...)
+}
+
+// runs the command line of args with ctx and returns its standard output
+func runArgsContext(t *testing.T, ctx context.Context, args ...string) (string, error) {
+	saved := make([]reflect.Value, len(flagVars))
+	for i, v := range flagVars {
+		saved[i] = reflect.ValueOf(reflect.ValueOf(v).Elem().Interface())
+	}
+	defer func() {
+		for i, v := range flagVars {
+			reflect.ValueOf(v).Elem().Set(saved[i])
+		}
+	}()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, _ := os.Open(os.DevNull)
+	defer devNull.Close()
+	os.Stdout, os.Stderr = w, devNull
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- string(data)
+	}()
+	err = runCommand(ctx, args)
+	w.Close()
+	os.Stdout, os.Stderr = stdout, stderr
+	return <-output, err
+}
+
+// returns a cache directory holding snapshots of the followers of alice,
+// bob and carol
+func newTestCacheDir(t *testing.T) string {
+	dir := t.TempDir()
+	store := twitterintersection.NewSnapshotStore(dir)
+	now := time.Now()
+	snapshots := []*twitterintersection.Snapshot{
+		{ScreenName: "alice", Relation: twitterintersection.Followers, FetchedAt: now.Add(-time.Hour), Ids: []uint64{1, 2}},
+		{ScreenName: "alice", Relation: twitterintersection.Followers, FetchedAt: now, Ids: []uint64{1, 2, 3, 4}},
+		{ScreenName: "bob", Relation: twitterintersection.Followers, FetchedAt: now, Ids: []uint64{3, 4, 5}},
+		{ScreenName: "carol", Relation: twitterintersection.Followers, FetchedAt: now, Ids: []uint64{4, 6}},
+	}
+	for _, snapshot := range snapshots {
+		if err := store.Save(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExitCodes(t *testing.T) {
+	if code := exitCode(nil); code != exitOK {
+		t.Error("bad exit code", code)
+	}
+	if code := exitCode(usageError("bad")); code != exitUsage {
+		t.Error("bad exit code", code)
+	}
+	if code := exitCode(errInterrupted); code != exitInterrupted {
+		t.Error("bad exit code", code)
+	}
+	if code := exitCode(errors.New("boom")); code != exitFailure {
+		t.Error("bad exit code", code)
+	}
+}
+
+func TestInterruptedExitCode(t *testing.T) {
+	var blockToken atomic.Bool
+	started := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the end of the request is noticed once its body is read
+		r.ParseForm()
+		if r.URL.Path == "/oauth2/token" && !blockToken.Load() {
+			fmt.Fprint(w, `{"token_type":"bearer","access_token":"token"}`)
+			return
+		}
+		// the token or the screen names are requested until the client
+		// gives up
+		select {
+		case started <- r.URL.Path:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	args := []string{"intersect", "-base-url", ts.URL, "-oauth2-url", ts.URL + "/oauth2", "-cache-dir", "", "-checkpoint-dir", "",
+		"-credentials", filepath.Join(t.TempDir(), "credentials.json"), "-consumer-key", "key", "-consumer-secret", "secret", "alice", "bob"}
+
+	for _, block := range []bool{true, false} {
+		blockToken.Store(block)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-started:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if _, err := runArgsContext(t, ctx, args...); exitCode(err) != exitInterrupted {
+			t.Error("a cancelled command should exit with 130", block, err)
+		}
+		cancel()
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	dir := newTestCacheDir(t)
+	commandLines := [][]string{
+		{},
+		{"intersect", "-offline", "-cache-dir", dir},
+		{"intersect", "-offline", "-cache-dir", dir, "alice &"},
+		{"query", "-offline", "-cache-dir", dir, "alice", "bob"},
+		{"stats", "-offline", "-cache-dir", dir, "alice"},
+		{"stats", "-offline", "-cache-dir", dir, "-output", "xml", "alice", "bob"},
+		{"stats", "-offline", "-cache-dir", dir, "-metric", "dice", "alice", "bob"},
+		{"diff", "-no-such-flag", "alice"},
+		{"diff", "-relation", "enemies", "alice"},
+		{"ids", "-offline", "-cache-dir", dir, "alice", "bob"},
+		{"lookup", "12", "bob"},
+		{"cache", "-cache-dir", dir, "purge"},
+		{"help", "nosuchcommand"},
+		{"intersect", "-offline", "-cache-dir", "", "alice", "bob"},
+	}
+	for _, args := range commandLines {
+		if _, err := runArgs(t, args...); exitCode(err) != exitUsage {
+			t.Error("expected a usage error for", args, err)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	if output, err := runArgs(t, "help"); err != nil || !strings.Contains(output, "intersect") || !strings.Contains(output, "exits with 0") {
+		t.Error("bad help", output, err)
+	}
+	output, err := runArgs(t, "help", "diff")
+	if err != nil || !strings.Contains(output, "usage: twitterintersection diff [flags] account") || !strings.Contains(output, "-from") {
+		t.Error("bad help of diff", output, err)
+	}
+	if _, err := runArgs(t, "stats", "-h"); err != nil {
+		t.Error("-h is not an error", err)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	dir := newTestCacheDir(t)
+	// there is no snapshot of dave
+	if _, err := runArgs(t, "intersect", "-offline", "-cache-dir", dir, "alice", "dave"); exitCode(err) != exitFailure {
+		t.Error("expected a failure", err)
+	}
+	if _, err := runArgs(t, "diff", "-offline", "-cache-dir", dir, "bob"); exitCode(err) != exitFailure {
+		t.Error("expected a failure", err)
+	}
+}
+
+func TestFlagsBeforeAndAfterTheCommand(t *testing.T) {
+	dir := newTestCacheDir(t)
+	cacheDir, offline = dir, true
+	defer func() { cacheDir, offline = defaultDataDir("snapshots"), false }()
+	if output, err := runArgs(t, "union", "alice", "bob"); err != nil || output != "1\n2\n3\n4\n5\n" {
+		t.Error("the flags given before the command should be kept", output, err)
+	}
+	if output, err := runArgs(t, "union", "-ttl", "1s", "carol", "bob"); err != nil || output != "3\n4\n5\n6\n" {
+		t.Error("bad union", output, err)
+	}
+}
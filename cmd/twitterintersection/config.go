@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the environment variables of the configuration file and of the profile
+const (
+	configEnv  = "TWITTERINTERSECTION_CONFIG"
+	profileEnv = "TWITTERINTERSECTION_PROFILE"
+)
+
+var (
+	configPath = defaultDataDir("config.toml")
+	profile    string
+)
+
+// the environment variables of the credentials, the other flags are read
+// from TWITTERINTERSECTION_ followed by their name in upper case
+var credentialsEnv = map[string]string{
+	"consumer-key":        "TWITTER_CONSUMER_KEY",
+	"consumer-secret":     "TWITTER_CONSUMER_SECRET",
+	"access-token":        "TWITTER_ACCESS_TOKEN",
+	"access-token-secret": "TWITTER_ACCESS_TOKEN_SECRET",
+}
+
+// registers on fs the flags selecting the configuration
+func addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", configPath, "configuration file, in toml")
+	fs.StringVar(&profile, "profile", profile, "profile of the configuration file to use")
+}
+
+// returns the environment variable of a flag
+func flagEnv(name string) string {
+	if env, ok := credentialsEnv[name]; ok {
+		return env
+	}
+	return "TWITTERINTERSECTION_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// config is a configuration file: settings shared by every profile and the
+// settings of named profiles, each keyed by the name of its flag.
+type config struct {
+	settings map[string]string
+	profiles map[string]map[string]string
+}
+
+// returns the value of a toml string, integer, float or boolean
+func parseTomlValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") || strings.Contains(value[1:len(value)-1], "'") {
+			return "", errors.New("bad literal string " + value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(strings.Replace(value, "_", "", -1), 64); err != nil {
+		return "", errors.New("bad value " + value)
+	}
+	return strings.Replace(value, "_", "", -1), nil
+}
+
+// removes the comment at the end of a line, outside of the strings
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			// the escaped character is skipped below
+			quote = '\\'
+		case quote == '\\':
+			quote = '"'
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// parses the subset of toml used by the configuration: key = value pairs,
+// the settings shared by every profile, followed by [profiles.name] tables
+func parseConfig(data string, known map[string]bool) (*config, error) {
+	c := &config{settings: make(map[string]string), profiles: make(map[string]map[string]string)}
+	table := c.settings
+	for i, line := range strings.Split(data, "\n") {
+		lineErr := func(msg string) error {
+			return errors.New("line " + strconv.Itoa(i+1) + ": " + msg)
+		}
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if !strings.HasSuffix(line, "]") || !strings.HasPrefix(name, "profiles.") || len(name) == len("profiles.") {
+				return nil, lineErr("expected a [profiles.name] table")
+			}
+			name = strings.Trim(strings.TrimPrefix(name, "profiles."), `"`)
+			if _, ok := c.profiles[name]; ok {
+				return nil, lineErr("profile " + name + " defined twice")
+			}
+			table = make(map[string]string)
+			c.profiles[name] = table
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, lineErr("expected key = value")
+		}
+		key := strings.TrimSpace(parts[0])
+		if !known[key] {
+			return nil, lineErr("unknown setting " + key)
+		}
+		value, err := parseTomlValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, lineErr(err.Error())
+		}
+		if _, ok := table[key]; ok {
+			return nil, lineErr(key + " set twice")
+		}
+		table[key] = value
+	}
+	return c, nil
+}
+
+// returns the names of the flags that can be set in the configuration
+func configurableFlags() map[string]bool {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	addTwitterFlags(fs)
+	addStoreFlags(fs)
+	addSpillFlags(fs)
+	known := map[string]bool{"profile": true}
+	fs.VisitAll(func(f *flag.Flag) { known[f.Name] = true })
+	return known
+}
+
+// reads the configuration file at path.  A missing file is an empty
+// configuration when it is not given explicitly.
+func readConfig(path string, explicit bool) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return &config{settings: make(map[string]string), profiles: make(map[string]map[string]string)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := parseConfig(string(data), configurableFlags())
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return c, nil
+}
+
+// returns the settings of the profile, the shared settings overridden by
+// the ones of the profile
+func (c *config) profile(name string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for k, v := range c.settings {
+		settings[k] = v
+	}
+	if name == "" {
+		return settings, nil
+	}
+	profile, ok := c.profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.profiles))
+		for name := range c.profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, usageError("unknown profile " + name + ", the profiles are: " + strings.Join(names, ", "))
+	}
+	for k, v := range profile {
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+// expands the ~ at the start of a path to the home directory
+func expandHome(value string) string {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(value, "~/") {
+		return filepath.Join(home, value[2:])
+	}
+	return value
+}
+
+// gives the flags of fs not set on the command line their value from the
+// environment or, else, from the profile of the configuration file.  set
+// holds the names of the flags given on the command line.
+func applyConfig(fs *flag.FlagSet, set map[string]bool) error {
+	explicit := set["config"]
+	if env := os.Getenv(configEnv); env != "" && !explicit {
+		configPath, explicit = env, true
+	}
+	var settings map[string]string
+	if configPath != "" {
+		c, err := readConfig(expandHome(configPath), explicit)
+		if err != nil {
+			return err
+		}
+		name := profile
+		if env := os.Getenv(profileEnv); env != "" && !set["profile"] {
+			name = env
+		} else if !set["profile"] {
+			name = c.settings["profile"]
+		}
+		if settings, err = c.profile(name); err != nil {
+			return err
+		}
+	} else if set["profile"] {
+		return usageError("-profile needs a configuration file")
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "config" || f.Name == "profile" {
+			return
+		}
+		value := os.Getenv(flagEnv(f.Name))
+		ok := value != ""
+		if !ok {
+			value, ok = settings[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, expandHome(value)); e != nil {
+			err = usageError("bad value " + value + " of " + f.Name + ": " + e.Error())
+		}
+	})
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := `
+# shared by every profile
+max-attempts = 5
+profile = "research"
+
+[profiles.research]
+consumer-key = "key # not a comment" # a comment
+cache-dir = '~/research/snapshots'
+rate-limit-max-wait = "10m"
+
+[profiles."ops"]
+offline = true
+`
+	c, err := parseConfig(data, configurableFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"max-attempts": "5", "profile": "research"}; !reflect.DeepEqual(c.settings, expected) {
+		t.Error("bad shared settings", c.settings)
+	}
+	if settings, err := c.profile("research"); err != nil {
+		t.Error(err)
+	} else if expected := (map[string]string{"max-attempts": "5", "profile": "research", "consumer-key": "key # not a comment",
+		"cache-dir": "~/research/snapshots", "rate-limit-max-wait": "10m"}); !reflect.DeepEqual(settings, expected) {
+		t.Error("bad settings of research", settings)
+	}
+	if settings, err := c.profile("ops"); err != nil || settings["offline"] != "true" {
+		t.Error("bad settings of ops", settings, err)
+	}
+	if _, err := c.profile("nope"); exitCode(err) != exitUsage {
+		t.Error("expected a usage error", err)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, data := range []string{
+		"max-attempts 5",
+		"no-such-setting = 1",
+		"proxy = http://localhost",
+		`proxy = "http://localhost`,
+		"max-attempts = 1\nmax-attempts = 2",
+		"[research]",
+		"[profiles.a]\n[profiles.a]",
+	} {
+		if _, err := parseConfig(data, configurableFlags()); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	dir := newTestCacheDir(t)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := "offline = true\ncache-dir = \"/no/such/dir\"\n\n[profiles.research]\ncache-dir = \"" + dir + "\"\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the profile gives the cache directory and the shared settings give -offline
+	if output, err := runArgs(t, "intersect", "-config", path, "-profile", "research", "alice", "bob"); err != nil || output != "3\n4\n" {
+		t.Error("the profile should be used", output, err)
+	}
+	if _, err := runArgs(t, "intersect", "-config", path, "alice", "bob"); exitCode(err) != exitFailure {
+		t.Error("the shared cache directory is empty", err)
+	}
+	// the environment overrides the file and the flags override both
+	t.Setenv("TWITTERINTERSECTION_CACHE_DIR", "/no/such/dir")
+	if _, err := runArgs(t, "intersect", "-config", path, "-profile", "research", "alice", "bob"); exitCode(err) != exitFailure {
+		t.Error("the environment should override the profile", err)
+	}
+	if output, err := runArgs(t, "intersect", "-config", path, "-profile", "research", "-cache-dir", dir, "alice", "bob"); err != nil || output != "3\n4\n" {
+		t.Error("the flags should override the environment", output, err)
+	}
+	t.Setenv("TWITTERINTERSECTION_PROFILE", "ops")
+	if _, err := runArgs(t, "intersect", "-config", path, "alice", "bob"); exitCode(err) != exitUsage {
+		t.Error("ops is not a profile", err)
+	}
+	if _, err := runArgs(t, "intersect", "-config", filepath.Join(t.TempDir(), "missing.toml"), "alice", "bob"); exitCode(err) != exitFailure {
+		t.Error("a missing configuration given explicitly is an error", err)
+	}
+}
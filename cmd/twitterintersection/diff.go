@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+// the accepted layouts of the -from and -to flags of the diff command
+var diffTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02", twitterintersection.SnapshotTimeLayout}
+
+func parseDiffTime(s string) (time.Time, error) {
+	for _, layout := range diffTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("bad time " + s + ", should look like 2006-01-02T15:04")
+}
+
+// returns the index of the newest time in times not after at, or -1
+func snapshotAt(times []time.Time, at time.Time) int {
+	i := -1
+	for j, t := range times {
+		if !t.After(at) {
+			i = j
+		}
+	}
+	return i
+}
+
+// selects, among the fetch times of the snapshots of an account, the two
+// snapshots to compare.  By default, the two newest snapshots are compared.
+func selectSnapshots(times []time.Time, from, to string) (old, new time.Time, err error) {
+	newIndex := len(times) - 1
+	if to != "" {
+		t, err := parseDiffTime(to)
+		if err != nil {
+			return old, new, err
+		}
+		newIndex = snapshotAt(times, t)
+	}
+	oldIndex := newIndex - 1
+	if from != "" {
+		t, err := parseDiffTime(from)
+		if err != nil {
+			return old, new, err
+		}
+		oldIndex = snapshotAt(times, t)
+	}
+	if oldIndex < 0 || newIndex < 0 || oldIndex >= newIndex {
+		return old, new, errors.New("need two distinct snapshots to compare")
+	}
+	return times[oldIndex], times[newIndex], nil
+}
+
+// prints the screen names of ids, or the ids themselves when the screen
+// names cannot be resolved, each prefixed by prefix
+func printUsers(ctx context.Context, followerGetter twitterintersection.FollowerGetter, prefix string, ids []uint64) error {
+	if followerGetter == nil {
+		for _, id := range ids {
+			fmt.Println(prefix + fmt.Sprint(id))
+		}
+		return nil
+	}
+	screenNameC, errc := twitterintersection.GetScreenNameByIds(ctx, followerGetter, twitterintersection.IdsChannel(ctx, ids))
+	for screenName := range screenNameC {
+		fmt.Println(prefix + screenName)
+	}
+	return <-errc
+}
+
+var diffCommand = &command{"diff", "account",
+	`print the users who joined, prefixed by "+", and who left, prefixed by "-", an account between two of its snapshots`,
+	setupDiff}
+
+func setupDiff(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	addStoreFlags(fs)
+	relationName := fs.String("relation", string(twitterintersection.Followers), "relation to compare, followers or friends")
+	from := fs.String("from", "", "time of the old snapshot, the one before the new snapshot by default")
+	to := fs.String("to", "", "time of the new snapshot, the newest snapshot by default")
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usageError("you need to specify exactly one twitter account name to diff")
+		}
+		relation, err := twitterintersection.ParseRelation(*relationName)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		account, err := twitterintersection.ParseAccount(args[0])
+		if err != nil {
+			return usageError(err.Error())
+		}
+		account.Relation = relation
+
+		store := twitterintersection.NewSnapshotStore(cacheDir)
+		if err := resolveAccounts(ctx, store, store, []*twitterintersection.AccountExpr{account}); err != nil {
+			return err
+		}
+		screenName := account.Account()
+		times, err := store.List(relation, screenName)
+		if err != nil {
+			return err
+		}
+		oldTime, newTime, err := selectSnapshots(times, *from, *to)
+		if err != nil {
+			return errors.New("cannot diff " + account.String() + ": " + err.Error())
+		}
+		old, err := store.Load(relation, screenName, oldTime)
+		if err != nil {
+			return err
+		}
+		new, err := store.Load(relation, screenName, newTime)
+		if err != nil {
+			return err
+		}
+		diff := twitterintersection.DiffSnapshots(old, new)
+
+		var t twitterintersection.FollowerGetter
+		if !offline {
+			if t, err = openTwitter(ctx); err != nil {
+				return err
+			}
+		}
+		if err := printUsers(ctx, t, "+", diff.Gained); err != nil {
+			return err
+		}
+		if err := printUsers(ctx, t, "-", diff.Lost); err != nil {
+			return err
+		}
+		fmt.Printf("%v gained, %v lost between %v (%v) and %v (%v)\n", len(diff.Gained), len(diff.Lost),
+			old.FetchedAt.Format(time.RFC3339), len(old.Ids), new.FetchedAt.Format(time.RFC3339), len(new.Ids))
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectSnapshots(t *testing.T) {
+	t1 := time.Date(2015, 3, 4, 10, 0, 0, 0, time.UTC)
+	t2 := time.Date(2015, 3, 5, 10, 0, 0, 0, time.UTC)
+	t3 := time.Date(2015, 3, 6, 10, 0, 0, 0, time.UTC)
+	times := []time.Time{t1, t2, t3}
+
+	if old, new, err := selectSnapshots(times, "", ""); err != nil || !old.Equal(t2) || !new.Equal(t3) {
+		t.Error("should compare the two newest snapshots", old, new, err)
+	}
+	if old, new, err := selectSnapshots(times, "2015-03-04T12:00", ""); err != nil || !old.Equal(t1) || !new.Equal(t3) {
+		t.Error("bad snapshots", old, new, err)
+	}
+	if old, new, err := selectSnapshots(times, "", "2015-03-05T12:00"); err != nil || !old.Equal(t1) || !new.Equal(t2) {
+		t.Error("bad snapshots", old, new, err)
+	}
+	if _, _, err := selectSnapshots(times, "", "2015-03-05"); err == nil {
+		t.Error("there is a single snapshot before the 5th")
+	}
+	if _, _, err := selectSnapshots(times[:1], "", ""); err == nil {
+		t.Error("a single snapshot cannot be compared")
+	}
+	if _, _, err := selectSnapshots(times, "yesterday", ""); err == nil {
+		t.Error("bad time")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+var lookupCommand = &command{"lookup", "[id...]",
+	`print the users of the ids, read on the standard input without arguments or with "-"`,
+	setupLookup}
+
+var idsCommand = &command{"ids", "account",
+	`print the ids of the followers of an account, or of its friends with "friends:account", one per line`,
+	setupIds}
+
+// returns the ids of the fields of r, separated by spaces or new lines
+func readIdList(r io.Reader) ([]uint64, error) {
+	ids := make([]uint64, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		id, err := strconv.ParseUint(scanner.Text(), 10, 64)
+		if err != nil {
+			return nil, usageError("bad id " + scanner.Text())
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+func setupLookup(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	outputFormat := fs.String("output", "text", "output format: "+strings.Join(twitterintersection.OutputFormats, ", "))
+	return func(ctx context.Context, args []string) error {
+		var ids []uint64
+		var err error
+		if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
+			ids, err = readIdList(os.Stdin)
+		} else {
+			ids, err = readIdList(strings.NewReader(strings.Join(args, " ")))
+		}
+		if err != nil {
+			return err
+		}
+		output, err := twitterintersection.NewUserWriter(*outputFormat, os.Stdout)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		t, err := openTwitter(ctx)
+		if err != nil {
+			return err
+		}
+		if err := writeUsers(ctx, t, twitterintersection.IdsChannel(ctx, ids), output); err != nil {
+			return err
+		}
+		return output.Close()
+	}
+}
+
+func setupIds(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	addStoreFlags(fs)
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usageError("you need to specify exactly one twitter account name")
+		}
+		account, err := twitterintersection.ParseAccount(args[0])
+		if err != nil {
+			return usageError(err.Error())
+		}
+		t, err := openFollowerGetter(ctx, []*twitterintersection.AccountExpr{account})
+		if err != nil {
+			return err
+		}
+		// the ids are written as they are received, they are incomplete when
+		// an error is returned
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		idsC, errc := twitterintersection.GetIds(ctx, t, account.Relation, account.Account())
+		for id := range idsC {
+			fmt.Fprintln(w, id)
+		}
+		return <-errc
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadIdList(t *testing.T) {
+	if ids, err := readIdList(strings.NewReader("12 34\n56\n\n")); err != nil || !reflect.DeepEqual(ids, []uint64{12, 34, 56}) {
+		t.Error("bad ids", ids, err)
+	}
+	if _, err := readIdList(strings.NewReader("12 bob")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestIdsOffline(t *testing.T) {
+	dir := newTestCacheDir(t)
+	if output, err := runArgs(t, "ids", "-offline", "-cache-dir", dir, "Alice"); err != nil || output != "1\n2\n3\n4\n" {
+		t.Error("bad ids", output, err)
+	}
+	if _, err := runArgs(t, "ids", "-offline", "-cache-dir", dir, "friends:alice"); exitCode(err) != exitFailure {
+		t.Error("there is no snapshot of the friends of alice", err)
+	}
+}
+
+func TestFailedLookupWritesNothing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+		fmt.Fprint(w, `{"errors":[{"code":200,"message":"Forbidden."}]}`)
+	}))
+	defer ts.Close()
+	output, err := runArgs(t, "lookup", "-base-url", ts.URL, "-credentials", filepath.Join(t.TempDir(), "credentials.json"),
+		"-consumer-key", "key", "-consumer-secret", "secret", "-access-token", "token", "-access-token-secret", "token secret",
+		"-output", "csv", "12", "34")
+	if exitCode(err) != exitFailure || output != "" {
+		t.Errorf("a failed lookup should write nothing: %q %v", output, err)
+	}
+}
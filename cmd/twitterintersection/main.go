@@ -0,0 +1,240 @@
+// Command twitterintersection prints the followers shared by twitter
+// accounts, or the users described by a set query over their followers and
+// friends.  Run "twitterintersection help" for the list of its commands.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+// the flags shared by the commands, given before or after the name of the
+// command
+var (
+	consumerKey       string
+	consumerSecret    string
+	accessToken       string
+	accessTokenSecret string
+	credentialsPath   = twitterintersection.DefaultCredentialsPath()
+	timeout           time.Duration
+	requestTimeout    = time.Minute
+	proxy             string
+	maxAttempts       = twitterintersection.DEFAULT_RETRY_MAX_ATTEMPTS
+	apiUrl            = twitterintersection.TWITTER_API_URL
+	oauth2Url         = twitterintersection.TWITTER_OAUTH2_URL
+	idsPageSize       = twitterintersection.DEFAULT_IDS_PAGE_SIZE
+	usersPageSize     = twitterintersection.DEFAULT_USERS_PAGE_SIZE
+	rateLimitMaxWait  time.Duration
+
+	checkpointDir = defaultDataDir("checkpoints")
+	resume        bool
+	cacheDir      = defaultDataDir("snapshots")
+	cacheTTL      = time.Hour
+	offline       bool
+
+	spillDir     string
+	spillRunSize = twitterintersection.DEFAULT_SPILL_RUN_SIZE
+)
+
+// registers on fs the flags of the commands using the twitter api.  The
+// values already given, before the name of the command, are the defaults.
+func addTwitterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&consumerKey, "consumer-key", consumerKey, "consumer key of the twitter application")
+	fs.StringVar(&consumerSecret, "consumer-secret", consumerSecret, "consumer secret of the twitter application")
+	fs.StringVar(&accessToken, "access-token", accessToken, "access token of the user, enables the user context authentication")
+	fs.StringVar(&accessTokenSecret, "access-token-secret", accessTokenSecret, "access token secret of the user")
+	fs.StringVar(&credentialsPath, "credentials", credentialsPath, "json file holding the credentials")
+	fs.DurationVar(&timeout, "timeout", timeout, "give up after this duration, no limit when zero")
+	fs.DurationVar(&requestTimeout, "request-timeout", requestTimeout, "give up a request to twitter after this duration")
+	fs.StringVar(&proxy, "proxy", proxy, "send the requests through this proxy, http://host:port or socks5://host:port")
+	fs.IntVar(&maxAttempts, "max-attempts", maxAttempts, "number of attempts of a request failing with a transient error")
+	fs.StringVar(&apiUrl, "base-url", apiUrl, "url of the twitter api")
+	fs.StringVar(&oauth2Url, "oauth2-url", oauth2Url, "url of the oauth2 endpoints of twitter, where the bearer tokens are requested")
+	fs.IntVar(&idsPageSize, "ids-page-size", idsPageSize, "number of ids requested per page")
+	fs.IntVar(&usersPageSize, "users-page-size", usersPageSize, "number of users requested per page")
+	fs.DurationVar(&rateLimitMaxWait, "rate-limit-max-wait", rateLimitMaxWait, "fail instead of waiting longer than this for the reset of a rate limit, no limit when zero")
+}
+
+// registers on fs the flags of the checkpoints and snapshots
+func addStoreFlags(fs *flag.FlagSet) {
+	fs.StringVar(&checkpointDir, "checkpoint-dir", checkpointDir, "directory where the progress of the crawls is saved")
+	fs.BoolVar(&resume, "resume", resume, "continue the crawls from their last checkpoint")
+	fs.StringVar(&cacheDir, "cache-dir", cacheDir, "directory where the snapshots of the accounts are kept")
+	fs.DurationVar(&cacheTTL, "ttl", cacheTTL, "how long a snapshot is used instead of fetching the account again")
+	fs.BoolVar(&offline, "offline", offline, "answer only from the snapshots, without using the twitter api")
+}
+
+// registers on fs the flags of the set operations on disk
+func addSpillFlags(fs *flag.FlagSet) {
+	fs.StringVar(&spillDir, "spill-dir", spillDir, "compute the set operations in sorted run files of this directory instead of in memory")
+	fs.IntVar(&spillRunSize, "spill-run-size", spillRunSize, "number of ids of an account held in memory before they are written in a run file")
+}
+
+// returns the directory sub of the data directory of the program, in the
+// home directory
+func defaultDataDir(sub string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".twitterintersection", sub)
+}
+
+// returns the options of the http client given on the command line
+func httpOptions() ([]twitterintersection.Option, error) {
+	opts := []twitterintersection.Option{
+		twitterintersection.WithTimeout(requestTimeout),
+		twitterintersection.WithRetryPolicy(twitterintersection.NewRetryPolicy(maxAttempts, twitterintersection.DEFAULT_RETRY_BASE_DELAY, twitterintersection.DEFAULT_RETRY_MAX_DELAY)),
+		twitterintersection.WithBaseURLs(apiUrl, oauth2Url),
+		twitterintersection.WithPageSizes(idsPageSize, usersPageSize),
+		twitterintersection.WithRateLimitMaxWait(rateLimitMaxWait),
+	}
+	if proxy != "" {
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, usageError("bad proxy " + proxy)
+		}
+		opts = append(opts, twitterintersection.WithProxy(proxyUrl))
+	}
+	return opts, nil
+}
+
+// returns the credentials given on the command line, or in the credentials
+// file
+func loadCredentials() ([]*twitterintersection.Credentials, error) {
+	flags := &twitterintersection.Credentials{
+		ConsumerKey:       consumerKey,
+		ConsumerSecret:    consumerSecret,
+		AccessToken:       accessToken,
+		AccessTokenSecret: accessTokenSecret,
+	}
+	return twitterintersection.LoadCredentials(flags, credentialsPath)
+}
+
+// returns a FollowerGetter using the twitter api with the credentials given
+// on the command line
+func openTwitter(ctx context.Context) (twitterintersection.FollowerGetter, error) {
+	credentials, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := httpOptions()
+	if err != nil {
+		return nil, err
+	}
+	t, _, err := twitterintersection.NewFollowerGetterFromCredentials(ctx, credentials, opts...)
+	return t, err
+}
+
+// returns the FollowerGetter of the command line, going through the
+// checkpoints and the snapshots, able to answer for the accounts.  The
+// screen names of the accounts are resolved to user ids, and an account
+// named many times is fetched once.
+func openFollowerGetter(ctx context.Context, accounts []*twitterintersection.AccountExpr) (twitterintersection.FollowerGetter, error) {
+	var t twitterintersection.FollowerGetter
+	var err error
+	if offline && cacheDir == "" {
+		return nil, usageError("the offline mode needs a cache directory")
+	} else if !offline {
+		if t, err = openTwitter(ctx); err != nil {
+			return nil, err
+		}
+		if checkpointDir != "" {
+			t = twitterintersection.NewCheckpointingGetter(t, twitterintersection.NewCheckpointStore(checkpointDir), resume)
+		}
+	}
+	if cacheDir != "" {
+		store := twitterintersection.NewSnapshotStore(cacheDir)
+		cache := twitterintersection.NewCachingGetter(t, store, cacheTTL, offline)
+		if !offline {
+			// the accounts are fetched again under their ids
+			store = nil
+		}
+		if err := resolveAccounts(ctx, cache, store, accounts); err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			if err := cache.Check(account.Relation, account.Account()); err != nil {
+				return nil, err
+			}
+		}
+		return twitterintersection.NewSharingGetter(cache, accounts), nil
+	}
+	if resolver, ok := t.(twitterintersection.ScreenNameResolver); ok {
+		if err := resolveAccounts(ctx, resolver, nil, accounts); err != nil {
+			return nil, err
+		}
+	}
+	return twitterintersection.NewSharingGetter(t, accounts), nil
+}
+
+// resolves the screen names of the accounts to user ids with resolver.
+// When store is not nil, an account keeps its screen name if its only
+// snapshots were saved under its screen name, before it was resolved.
+func resolveAccounts(ctx context.Context, resolver twitterintersection.ScreenNameResolver, store *twitterintersection.SnapshotStore, accounts []*twitterintersection.AccountExpr) error {
+	if err := twitterintersection.ResolveAccounts(ctx, resolver, accounts); err != nil {
+		return fmt.Errorf("cannot resolve the screen names: %w", err)
+	}
+	for _, account := range accounts {
+		if store == nil || account.Id == 0 || account.ScreenName == "" {
+			continue
+		}
+		byId, err := store.List(account.Relation, account.Account())
+		if err != nil {
+			return err
+		}
+		byName, err := store.List(account.Relation, account.ScreenName)
+		if err != nil {
+			return err
+		}
+		if len(byId) == 0 && len(byName) > 0 {
+			account.Id = 0
+		}
+	}
+	return nil
+}
+
+// returns the SetEngine of the command line
+func newSetEngine() twitterintersection.SetEngine {
+	if spillDir != "" {
+		return twitterintersection.NewDiskEngine(spillDir, spillRunSize)
+	}
+	return twitterintersection.MemoryEngine{}
+}
+
+func main() {
+	addTwitterFlags(flag.CommandLine)
+	addStoreFlags(flag.CommandLine)
+	addSpillFlags(flag.CommandLine)
+	addConfigFlags(flag.CommandLine)
+	invalidateToken := flag.Bool("invalidate-token", false, "invalidate the bearer token of the application and exit, same as the auth -invalidate command")
+	version := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = printUsage
+	flag.Parse()
+	if *version {
+		fmt.Println("twitterintersection", twitterintersection.Version)
+		return
+	}
+
+	// ctrl-c cancels every request in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	args := flag.Args()
+	if *invalidateToken {
+		args = []string{"auth", "-invalidate"}
+	}
+	err := runCommand(ctx, args)
+	if err != nil && err.Error() != "" {
+		log.Println(err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+var intersectCommand = &command{"intersect", "operand...",
+	`print the users in every operand: an account, a query, a list "@file" or "-" for the standard input`,
+	func(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+		return setupQuery(fs, "&")
+	}}
+
+var unionCommand = &command{"union", "operand...",
+	`print the users in at least one operand: an account, a query, a list "@file" or "-" for the standard input`,
+	func(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+		return setupQuery(fs, "|")
+	}}
+
+var queryCommand = &command{"query", "query",
+	`print the users described by a query such as "(alice & bob) - carol"`,
+	func(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+		run := setupQuery(fs, "&")
+		return func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return usageError("you need to specify exactly one query, quoted")
+			}
+			return run(ctx, args)
+		}
+	}}
+
+// returns the query combining the operands of the command line with op.  A
+// single operand is parsed as a query.
+func queryFromArgs(args []string, op string) (twitterintersection.Expr, error) {
+	if len(args) == 1 {
+		return twitterintersection.ParseQuery(args[0])
+	}
+	return twitterintersection.ParseQuery("(" + strings.Join(args, ") "+op+" (") + ")")
+}
+
+func setupQuery(fs *flag.FlagSet, op string) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	addStoreFlags(fs)
+	addSpillFlags(fs)
+	outputFormat := fs.String("output", "text", "output format: "+strings.Join(twitterintersection.OutputFormats, ", "))
+	return func(ctx context.Context, args []string) error {
+		if len(args) < 1 {
+			return usageError("you need to specify a query or the name of at least two twitter accounts")
+		}
+		query, err := queryFromArgs(args, op)
+		if err != nil {
+			return usageError("bad query: " + err.Error())
+		}
+		output, err := twitterintersection.NewUserWriter(*outputFormat, os.Stdout)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		t, err := openFollowerGetter(ctx, twitterintersection.QueryAccounts(query))
+		if err != nil {
+			return err
+		}
+		// an empty json array or a lone csv header would pass for a result
+		if err := runQuery(ctx, t, query, output); err != nil {
+			return err
+		}
+		return output.Close()
+	}
+}
+
+// writes the users of the query in output, once every account is completely
+// fetched so an incomplete result is never written.  With -spill-dir, the
+// result waits on disk instead of in memory.
+func runQuery(ctx context.Context, t twitterintersection.FollowerGetter, query twitterintersection.Expr, output twitterintersection.UserWriter) error {
+	engine := newSetEngine()
+	idsC, queryErrc := query.Eval(ctx, t, engine)
+	var resultErrc <-chan error
+	if disk, ok := engine.(*twitterintersection.DiskEngine); ok {
+		result, err := disk.Spill(ctx, idsC)
+		if queryErr := twitterintersection.WaitErrors(queryErrc); queryErr != nil {
+			if result != nil {
+				result.Remove()
+			}
+			return queryErr
+		} else if err != nil {
+			return err
+		}
+		defer result.Remove()
+		idsC, resultErrc = result.Ids(ctx)
+	} else {
+		ids := twitterintersection.ReadIds(idsC)
+		if err := twitterintersection.WaitErrors(queryErrc); err != nil {
+			return err
+		}
+		idsC = twitterintersection.IdsChannel(ctx, ids)
+	}
+	if err := writeResult(ctx, t, idsC, output); err != nil || resultErrc == nil {
+		return err
+	}
+	return twitterintersection.WaitErrors(resultErrc)
+}
+
+// writes the users of idsC in output
+func writeResult(ctx context.Context, t twitterintersection.FollowerGetter, idsC <-chan uint64, output twitterintersection.UserWriter) error {
+	if !offline {
+		return writeUsers(ctx, t, idsC, output)
+	}
+	// only the ids are in the snapshots
+	for id := range idsC {
+		if err := output.Write(&twitterintersection.User{Id: id}); err != nil {
+			// the ids are still read so they are not blocked
+			for range idsC {
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the users of idsC in output, the suspended or deleted users are
+// reported and left out
+func writeUsers(ctx context.Context, t twitterintersection.FollowerGetter, idsC <-chan uint64, output twitterintersection.UserWriter) error {
+	lookupC, lookupErrc := twitterintersection.LookupUsers(ctx, t, idsC)
+	for lookup := range lookupC {
+		if lookup.Missing() {
+			log.Printf("user %v not found, it is suspended or deleted", lookup.Id)
+		} else if err := output.Write(lookup.User); err != nil {
+			// the lookups are still read so they are not blocked
+			for range lookupC {
+			}
+			return err
+		}
+	}
+	return twitterintersection.WaitErrors(lookupErrc)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+func TestQueryFromArgs(t *testing.T) {
+	if expr, err := queryFromArgs([]string{"alice", "bob", "carol"}, "&"); err != nil {
+		t.Error(err)
+	} else if expr.String() != "((alice & bob) & carol)" {
+		t.Error(expr)
+	}
+	if expr, err := queryFromArgs([]string{"alice", "bob - carol"}, "|"); err != nil {
+		t.Error(err)
+	} else if expr.String() != "(alice | (bob - carol))" {
+		t.Error(expr)
+	}
+}
+
+func TestOfflineQueries(t *testing.T) {
+	dir := newTestCacheDir(t)
+	commandLines := map[string][]string{
+		"3\n4\n":    {"intersect", "-offline", "-cache-dir", dir, "alice", "bob"},
+		"4\n":       {"-offline", "-cache-dir", dir, "alice", "bob", "carol"},
+		"1\n2\n6\n": {"query", "-offline", "-cache-dir", dir, "(alice | carol) - bob"},
+		"3\n4\n6\n": {"union", "-offline", "-cache-dir", dir, "-spill-dir", t.TempDir(), "bob & alice", "carol"},
+	}
+	for expected, args := range commandLines {
+		if output, err := runArgs(t, args...); err != nil || output != expected {
+			t.Error(args, "expected", expected, "but received", output, err)
+		}
+	}
+}
+
+func TestOfflineQueriesByUserId(t *testing.T) {
+	dir := newTestCacheDir(t)
+	store := twitterintersection.NewSnapshotStore(dir)
+	store.Save(&twitterintersection.Snapshot{ScreenName: twitterintersection.IdAccount(42), Relation: twitterintersection.Followers, FetchedAt: time.Now(), Ids: []uint64{3, 4, 9}})
+	// carol is resolved but its only snapshot is under its screen name
+	store.SaveScreenNames(map[string]uint64{"dave": 42, "carol": 99})
+	commandLines := map[string][]string{
+		"3\n4\n":    {"intersect", "-offline", "-cache-dir", dir, "alice", "Dave"},
+		"3\n4\n9\n": {"intersect", "-offline", "-cache-dir", dir, "id:42"},
+		"4\n":       {"intersect", "-offline", "-cache-dir", dir, "dave", "CAROL"},
+	}
+	for expected, args := range commandLines {
+		if output, err := runArgs(t, args...); err != nil || output != expected {
+			t.Error(args, "expected", expected, "but received", output, err)
+		}
+	}
+	if output, err := runArgs(t, "cache", "-cache-dir", dir, "clear", "dave"); err != nil || output != "dave: 1 snapshots removed\n" {
+		t.Error("the snapshots of dave are under the id of the user", output, err)
+	}
+}
+
+func TestOfflineQueriesWithLists(t *testing.T) {
+	dir := newTestCacheDir(t)
+	twitterintersection.NewSnapshotStore(dir).SaveScreenNames(map[string]uint64{"dave": 5})
+	crm := filepath.Join(t.TempDir(), "crm.csv")
+	ioutil.WriteFile(crm, []byte("name,twitter\nDave,@Dave\nEve,eve\nFrank,4\n"), 0644)
+	if output, err := runArgs(t, "union", "-offline", "-cache-dir", dir, "carol & bob", "@"+crm+"#twitter"); err != nil || output != "4\n5\n" {
+		t.Error("bad union", output, err)
+	}
+	if _, err := runArgs(t, "intersect", "-offline", "-cache-dir", dir, "bob", "@"+crm+"#email"); exitCode(err) != exitFailure {
+		t.Error("there is no email column", err)
+	}
+}
+
+func TestFailedQueryWritesNothing(t *testing.T) {
+	dir := newTestCacheDir(t)
+	for _, format := range []string{"json", "csv"} {
+		// there is no snapshot of dave
+		if output, err := runArgs(t, "intersect", "-offline", "-cache-dir", dir, "-output", format, "alice", "dave"); exitCode(err) != exitFailure || output != "" {
+			t.Errorf("a failed query should write nothing in %v: %q %v", format, output, err)
+		}
+	}
+	spillDir := t.TempDir()
+	if output, err := runArgs(t, "intersect", "-offline", "-cache-dir", dir, "-spill-dir", spillDir, "alice", "dave"); exitCode(err) != exitFailure || output != "" {
+		t.Errorf("a failed query should write nothing with -spill-dir: %q %v", output, err)
+	}
+	if output, err := runArgs(t, "union", "-offline", "-cache-dir", dir, "-spill-dir", spillDir, "alice", "carol"); err != nil || output != "1\n2\n3\n4\n6\n" {
+		t.Errorf("bad union with -spill-dir: %q %v", output, err)
+	}
+	if files, _ := ioutil.ReadDir(spillDir); len(files) != 0 {
+		t.Error("the spilled files should be removed", len(files))
+	}
+	if output, err := runArgs(t, "intersect", "-offline", "-cache-dir", dir, "-output", "json", "alice", "carol"); err != nil || !strings.HasPrefix(output, "[") {
+		t.Errorf("bad json output %q %v", output, err)
+	}
+}
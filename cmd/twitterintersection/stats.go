@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+var statsCommand = &command{"stats", "operand operand...",
+	"print how much the users of the operands, accounts or queries, overlap: the Jaccard index, the overlap coefficient and the sizes of the intersection and union of every pair",
+	setupStats}
+
+func setupStats(fs *flag.FlagSet) func(ctx context.Context, args []string) error {
+	addTwitterFlags(fs)
+	addStoreFlags(fs)
+	format := fs.String("output", "table", "output format: "+strings.Join(twitterintersection.StatsFormats, ", "))
+	metric := fs.String("metric", "jaccard", "metric of the matrix: "+strings.Join(twitterintersection.StatsMetrics, ", "))
+	return func(ctx context.Context, args []string) error {
+		if len(args) < 2 {
+			return usageError("you need to specify at least two twitter account names or queries to compare")
+		}
+		queries := make([]twitterintersection.Expr, len(args))
+		accounts := make([]*twitterintersection.AccountExpr, 0)
+		for i, arg := range args {
+			query, err := twitterintersection.ParseQuery(arg)
+			if err != nil {
+				return usageError("bad query: " + err.Error())
+			}
+			queries[i] = query
+			accounts = append(accounts, twitterintersection.QueryAccounts(query)...)
+		}
+		t, err := openFollowerGetter(ctx, accounts)
+		if err != nil {
+			return err
+		}
+		stats, err := twitterintersection.QueryStats(ctx, t, queries)
+		if err != nil {
+			return err
+		}
+		if err := twitterintersection.WriteStats(os.Stdout, stats, *format, *metric); err != nil {
+			// the format or the metric is unknown
+			return usageError(err.Error())
+		}
+		return nil
+	}
+}
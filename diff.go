@@ -0,0 +1,41 @@
+package twitterintersection
+
+import (
+	"context"
+)
+
+// SnapshotDiff is the difference between two snapshots of the same account.
+type SnapshotDiff struct {
+	Old, New *Snapshot
+	// the ids in New but not in Old
+	Gained []uint64
+	// the ids in Old but not in New
+	Lost []uint64
+}
+
+// DiffSnapshots returns the users that joined and left between the snapshots
+// old and new.
+func DiffSnapshots(old, new *Snapshot) *SnapshotDiff {
+	// the snapshots are in memory, there is nothing to cancel
+	ctx := context.Background()
+	gainedC := Difference(ctx, IdsChannel(ctx, new.Ids), IdsChannel(ctx, old.Ids))
+	lostC := Difference(ctx, IdsChannel(ctx, old.Ids), IdsChannel(ctx, new.Ids))
+	diff := &SnapshotDiff{Old: old, New: new}
+	done := make(chan bool)
+	go func() {
+		diff.Lost = ReadIds(lostC)
+		done <- true
+	}()
+	diff.Gained = ReadIds(gainedC)
+	<-done
+	return diff
+}
+
+// ReadIds returns all the ids of c, once it is closed.
+func ReadIds(c <-chan uint64) []uint64 {
+	ids := make([]uint64, 0)
+	for id := range c {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,23 @@
+package twitterintersection
+
+import (
+	"sort"
+	"testing"
+)
+
+func sortedIds(ids []uint64) []uint64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	old := &Snapshot{Ids: []uint64{1, 2, 3, 4}}
+	new := &Snapshot{Ids: []uint64{3, 4, 5, 6, 7}}
+	diff := DiffSnapshots(old, new)
+	if !equalsAsMultiSet(sortedIds(diff.Gained), []uint64{5, 6, 7}) || len(diff.Gained) != 3 {
+		t.Error("bad gained ids", diff.Gained)
+	}
+	if !equalsAsMultiSet(sortedIds(diff.Lost), []uint64{1, 2}) || len(diff.Lost) != 2 {
+		t.Error("bad lost ids", diff.Lost)
+	}
+}
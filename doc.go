@@ -0,0 +1,24 @@
+// Package twitterintersection computes set operations over the followers and
+// friends of twitter accounts.
+//
+// A TwitterApi, or a TokenPool of them, fetches the pages of ids of the
+// accounts.  It implements FollowerGetter, the source of the ids of every
+// function of the package, that can also go through a CheckpointingGetter to
+// resume interrupted crawls and a CachingGetter to reuse the snapshots of the
+// accounts.  GetFollowerIds and GetIds stream the ids of an account, which
+// Intersection, Union, AtLeast, Difference and SymmetricDifference combine.
+// A query such as "(alice & bob) - carol" is parsed by ParseQuery and
+// evaluated by a SetEngine, in memory with IdSets or on disk with a
+// DiskEngine.
+//
+// The functions returning channels return an error channel as well, that
+// receives the error that stopped them, if any, and the channels are closed
+// at the end.  They stop when their context is done.
+//
+// The command line program is in cmd/twitterintersection.
+package twitterintersection
+
+// Version is the version of the package, following semantic versioning: the
+// exported API is only changed in an incompatible way with a new major
+// version.
+const Version = "1.0.0"
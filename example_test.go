@@ -0,0 +1,128 @@
+package twitterintersection_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/didiercrunch/twitterintersection"
+)
+
+// staticGetter is a FollowerGetter answering from a map of the ids of the
+// accounts, keyed by "relation:screen name", in a single page.
+type staticGetter map[string][]uint64
+
+func (g staticGetter) GetUsersByCursor(ctx context.Context, relation twitterintersection.Relation, screenName, cursor string) <-chan *twitterintersection.FollowerList {
+	c := make(chan *twitterintersection.FollowerList, 1)
+	c <- &twitterintersection.FollowerList{NextCursor: "0"}
+	return c
+}
+
+func (g staticGetter) GetIdsByCursor(ctx context.Context, relation twitterintersection.Relation, screenName, cursor string) <-chan *twitterintersection.FollowerIDList {
+	c := make(chan *twitterintersection.FollowerIDList, 1)
+	c <- &twitterintersection.FollowerIDList{NextCursor: "0", Followers: g[string(relation)+":"+screenName]}
+	return c
+}
+
+func (g staticGetter) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *twitterintersection.UserLookup {
+	c := make(chan *twitterintersection.UserLookup, len(ids))
+	for _, id := range ids {
+		user := &twitterintersection.User{Id: id, ScreenName: fmt.Sprint("user", id)}
+		c <- &twitterintersection.UserLookup{Id: id, User: user}
+	}
+	close(c)
+	return c
+}
+
+var accounts = staticGetter{
+	"followers:alice": {1, 2, 3, 4},
+	"followers:bob":   {3, 4, 5},
+	"followers:carol": {4, 6},
+	"friends:alice":   {5, 6},
+}
+
+func Example() {
+	// with the twitter api, the FollowerGetter would be
+	// twitterintersection.NewTwitterApi(twitterintersection.TWITTER_API_URL, token)
+	var fg twitterintersection.FollowerGetter = accounts
+	ctx := context.Background()
+	alice, aliceErrc := twitterintersection.GetFollowerIds(ctx, fg, "alice")
+	bob, bobErrc := twitterintersection.GetFollowerIds(ctx, fg, "bob")
+	shared := twitterintersection.Intersection(ctx, alice, bob)
+	screenNames, lookupErrc := twitterintersection.GetScreenNameByIds(ctx, fg, shared)
+	for screenName := range screenNames {
+		fmt.Println(screenName)
+	}
+	if err := twitterintersection.WaitErrors(aliceErrc, bobErrc, lookupErrc); err != nil {
+		log.Fatal(err)
+	}
+	// Unordered output:
+	// user3
+	// user4
+}
+
+func ExampleParseQuery() {
+	query, err := twitterintersection.ParseQuery("(alice | friends:alice) - carol")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ids, errc := query.Eval(context.Background(), accounts, twitterintersection.MemoryEngine{})
+	fmt.Println(query, twitterintersection.ReadIds(ids))
+	if err := twitterintersection.WaitErrors(errc); err != nil {
+		log.Fatal(err)
+	}
+	// Output: ((alice | friends:alice) - carol) [1 2 3 5]
+}
+
+func ExampleNewDiskEngine() {
+	dir, err := os.MkdirTemp("", "spill")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// at most 2 ids of an operand are held in memory
+	engine := twitterintersection.NewDiskEngine(dir, 2)
+	query, _ := twitterintersection.ParseQuery("atleast(2, alice, bob, carol)")
+	ids, errc := query.Eval(context.Background(), accounts, engine)
+	fmt.Println(twitterintersection.ReadIds(ids))
+	if err := twitterintersection.WaitErrors(errc); err != nil {
+		log.Fatal(err)
+	}
+	// Output: [3 4]
+}
+
+func ExampleIdSet() {
+	a := twitterintersection.NewIdSet([]uint64{4, 1, 3, 2, 3})
+	b := twitterintersection.IdSet{3, 4, 5}
+	fmt.Println(a, a.Intersect(b), a.Union(b), a.Difference(b), a.SymmetricDifference(b))
+	// Output: [1 2 3 4] [3 4] [1 2 3 4 5] [1 2] [1 2 5]
+}
+
+func ExampleWriteStats() {
+	names := []string{"alice", "bob", "carol"}
+	sets := []twitterintersection.IdSet{accounts["followers:alice"], accounts["followers:bob"], accounts["followers:carol"]}
+	stats := twitterintersection.NewOverlapStats(names, sets)
+	if err := twitterintersection.WriteStats(os.Stdout, stats, "csv", "jaccard"); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// set,size,alice,bob,carol
+	// alice,4,1.0000,0.4000,0.2000
+	// bob,3,0.4000,1.0000,0.2500
+	// carol,2,0.2000,0.2500,1.0000
+}
+
+func ExampleNewTwitterApi() {
+	api := twitterintersection.NewTwitterApi(twitterintersection.TWITTER_API_URL, "bearer token",
+		twitterintersection.WithTimeout(time.Minute),
+		twitterintersection.WithUserAgent("myservice/1.0"))
+	ids, errc := twitterintersection.GetFollowerIds(context.Background(), api, "alice")
+	for id := range ids {
+		fmt.Println(id)
+	}
+	if err := <-errc; err != nil {
+		log.Println(err)
+	}
+}
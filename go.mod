@@ -0,0 +1,3 @@
+module github.com/didiercrunch/twitterintersection
+
+go 1.21
@@ -0,0 +1,223 @@
+package twitterintersection
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ListExpr is an operand of a query read from a file, or from the standard
+// input when Path is "-": the users of a list of ids and screen names,
+// separated by spaces or new lines, or of a column of a csv file.
+type ListExpr struct {
+	Path string
+	// the header of the csv column holding the users, the first column when
+	// empty.  A file is read as csv when it has a column or a .csv extension.
+	Column string
+}
+
+// the content of the standard input, read once so that many operands can
+// use it
+var stdin = new(stdinContent)
+
+type stdinContent struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+func (s *stdinContent) read() ([]byte, error) {
+	s.once.Do(func() {
+		s.data, s.err = ioutil.ReadAll(os.Stdin)
+	})
+	return s.data, s.err
+}
+
+// ParseList parses an operand such as "@ids.txt", "@customers.csv#twitter"
+// or "-" for the standard input.
+func ParseList(operand string) (*ListExpr, error) {
+	if operand == "-" {
+		return &ListExpr{Path: "-"}, nil
+	} else if !strings.HasPrefix(operand, "@") {
+		return nil, errors.New("bad list " + operand)
+	}
+	path, column := operand[1:], ""
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		path, column = path[:i], path[i+1:]
+		if column == "" {
+			return nil, errors.New("bad list " + operand + ", the column is empty")
+		}
+	}
+	if path == "" {
+		return nil, errors.New("bad list " + operand)
+	}
+	return &ListExpr{path, column}, nil
+}
+
+func (e *ListExpr) String() string {
+	if e.Path == "-" {
+		return "-"
+	} else if e.Column != "" {
+		return "@" + e.Path + "#" + e.Column
+	}
+	return "@" + e.Path
+}
+
+func (e *ListExpr) isCsv() bool {
+	return e.Column != "" || strings.EqualFold(filepath.Ext(e.Path), ".csv")
+}
+
+// returns the content of the list
+func (e *ListExpr) read() ([]byte, error) {
+	if e.Path == "-" {
+		return stdin.read()
+	}
+	return ioutil.ReadFile(e.Path)
+}
+
+// adds an entry of a list, an id or a screen name optionally prefixed by
+// "@", to ids or screenNames.  A screen name made of digits only must be
+// prefixed by "@" to not be read as an id.
+func addListEntry(entry string, ids []uint64, screenNames []string) ([]uint64, []string, error) {
+	if id, err := strconv.ParseUint(entry, 10, 64); err == nil {
+		return append(ids, id), screenNames, nil
+	}
+	name := strings.TrimPrefix(entry, "@")
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isWordRune(r) || r == ':' }) >= 0 {
+		return nil, nil, errors.New("bad id or screen name " + entry)
+	}
+	return ids, append(screenNames, name), nil
+}
+
+// ReadList returns the ids and the screen names listed by r, separated by
+// spaces or new lines.  When csv is true, r is read as a csv file with a
+// header and the users are in column, the first column when empty.
+func ReadList(r io.Reader, csv bool, column string) (ids []uint64, screenNames []string, err error) {
+	if csv {
+		return readCsvList(r, column)
+	}
+	ids, screenNames = make([]uint64, 0), make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		if ids, screenNames, err = addListEntry(scanner.Text(), ids, screenNames); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, screenNames, scanner.Err()
+}
+
+func readCsvList(r io.Reader, column string) (ids []uint64, screenNames []string, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("the csv file has no header")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	index := -1
+	for i, name := range header {
+		if column == "" || strings.EqualFold(strings.TrimSpace(name), column) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil, errors.New("no column " + column + " in the csv file")
+	}
+	ids, screenNames = make([]uint64, 0), make([]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return ids, screenNames, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if index >= len(record) || strings.TrimSpace(record[index]) == "" {
+			continue
+		}
+		if ids, screenNames, err = addListEntry(strings.TrimSpace(record[index]), ids, screenNames); err != nil {
+			line, _ := reader.FieldPos(index)
+			return nil, nil, errors.New("line " + strconv.Itoa(line) + ": " + err.Error())
+		}
+	}
+}
+
+// returns the ids of the users of the list, sorted and without repetitions.
+// Its screen names are resolved by followerGetter, the ones of no user are
+// reported and left out.
+func (e *ListExpr) ids(ctx context.Context, followerGetter FollowerGetter) ([]uint64, error) {
+	data, err := e.read()
+	if err != nil {
+		return nil, err
+	}
+	ids, screenNames, err := ReadList(bytes.NewReader(data), e.isCsv(), e.Column)
+	if err != nil {
+		return nil, errors.New(e.String() + ": " + err.Error())
+	}
+	if len(screenNames) > 0 {
+		resolver, ok := followerGetter.(ScreenNameResolver)
+		if !ok {
+			return nil, errors.New(e.String() + ": the screen names of the list cannot be resolved")
+		}
+		resolved, err := resolver.ResolveScreenNames(ctx, screenNames)
+		if err != nil {
+			return nil, fmt.Errorf("%v: cannot resolve the screen names: %w", e, err)
+		}
+		missing := 0
+		for _, name := range screenNames {
+			if id, ok := resolved[strings.ToLower(name)]; ok {
+				ids = append(ids, id)
+			} else {
+				missing++
+			}
+		}
+		if missing > 0 {
+			log.Printf("%v: %v screen names of no user left out", e, missing)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	distinct := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if len(distinct) == 0 || id != distinct[len(distinct)-1] {
+			distinct = append(distinct, id)
+		}
+	}
+	return distinct, nil
+}
+
+// Eval returns the ids of the users of the list, read and resolved in the
+// background.
+func (e *ListExpr) Eval(ctx context.Context, followerGetter FollowerGetter, engine SetEngine) (<-chan uint64, <-chan error) {
+	idsC := make(chan uint64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(idsC)
+		ids, err := e.ids(ctx, followerGetter)
+		if err != nil {
+			errc <- err
+			return
+		}
+		for _, id := range ids {
+			if !send(ctx, idsC, id) {
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return idsC, errc
+}
@@ -0,0 +1,123 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	lists := map[string]*ListExpr{
+		"-":                          {Path: "-"},
+		"@ids.txt":                   {Path: "ids.txt"},
+		"@crm/customers.csv#twitter": {Path: "crm/customers.csv", Column: "twitter"},
+		"@a#b#c":                     {Path: "a#b", Column: "c"},
+	}
+	for operand, expected := range lists {
+		if list, err := ParseList(operand); err != nil || !reflect.DeepEqual(list, expected) {
+			t.Error("bad list", operand, list, err)
+		} else if list.String() != operand {
+			t.Error("bad string", list)
+		}
+	}
+	for _, operand := range []string{"", "@", "@#a", "@a#", "ids.txt"} {
+		if _, err := ParseList(operand); err == nil {
+			t.Error("expected an error for", operand)
+		}
+	}
+}
+
+func TestReadList(t *testing.T) {
+	if ids, names, err := ReadList(strings.NewReader("12 alice\n@Bob\n\n@1234 34\n"), false, ""); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(ids, []uint64{12, 34}) || !reflect.DeepEqual(names, []string{"alice", "Bob", "1234"}) {
+		t.Error("bad list", ids, names)
+	}
+	csv := "name,Twitter,id\nAlice,@alice,1\nBob,,2\n\"Carol, Jr\",carol_jr,3\nDave\n"
+	if ids, names, err := ReadList(strings.NewReader(csv), true, "twitter"); err != nil {
+		t.Error(err)
+	} else if len(ids) != 0 || !reflect.DeepEqual(names, []string{"alice", "carol_jr"}) {
+		t.Error("bad twitter column", ids, names)
+	}
+	if ids, _, err := ReadList(strings.NewReader(csv), true, "id"); err != nil || !reflect.DeepEqual(ids, []uint64{1, 2, 3}) {
+		t.Error("bad id column", ids, err)
+	}
+	if _, names, err := ReadList(strings.NewReader("handle\nalice\nbob\n"), true, ""); err != nil || !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+		t.Error("the first column should be used", names, err)
+	}
+	for _, c := range []struct {
+		data   string
+		csv    bool
+		column string
+	}{
+		{"alice b-o-b", false, ""},
+		{"friends:alice", false, ""},
+		{"", true, ""},
+		{"name,id\nalice,1", true, "twitter"},
+		{"name\nCarol Jr", true, ""},
+	} {
+		if _, _, err := ReadList(strings.NewReader(c.data), c.csv, c.column); err == nil {
+			t.Errorf("expected an error for %q", c.data)
+		}
+	}
+}
+
+func TestEvalList(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "ids.txt"), []byte("4 3 3 99\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "crm.csv"), []byte("email,handle\na@example.com,@A\nb@example.com,nobody\nc@example.com,c\n"), 0644)
+	defer func(content *stdinContent) { stdin = content }(stdin)
+	stdin = new(stdinContent)
+	stdin.once.Do(func() { stdin.data = []byte("3\n5\n") })
+
+	fg := struct {
+		mapFollowerGetter
+		ScreenNameResolver
+	}{mapFollowerGetter{
+		"a": {1, 2, 3, 4},
+		"b": {3, 4, 5},
+	}, &recordingResolver{ids: map[string]uint64{"a": 1, "c": 6}}}
+	queries := map[string]string{
+		"@" + filepath.Join(dir, "ids.txt"):        "[3 4 99]",
+		"a & @" + filepath.Join(dir, "ids.txt"):    "[3 4]",
+		"@" + filepath.Join(dir, "crm.csv#HANDLE"): "[1 6]",
+		"b - -": "[4]",
+		"- | @" + filepath.Join(dir, "ids.txt") + " & b": "[3 4 5]",
+	}
+	for query, expected := range queries {
+		if ids := evalQuery(t, query, fg, MemoryEngine{}); fmt.Sprint(ids) != expected {
+			t.Error(query, "expected", expected, "but received", ids)
+		}
+	}
+
+	expr, _ := ParseQuery("a & @" + filepath.Join(dir, "crm.csv"))
+	if _, errc := expr.Eval(context.Background(), mapFollowerGetter{"a": {1}}, MemoryEngine{}); WaitErrors(errc) == nil {
+		t.Error("the screen names cannot be resolved without a ScreenNameResolver")
+	}
+	cancelled := struct {
+		mapFollowerGetter
+		ScreenNameResolver
+	}{mapFollowerGetter{}, failingResolver{context.Canceled}}
+	expr, _ = ParseQuery("@" + filepath.Join(dir, "crm.csv#handle"))
+	if _, errc := expr.Eval(context.Background(), cancelled, MemoryEngine{}); !errors.Is(WaitErrors(errc), context.Canceled) {
+		t.Error("the error of the resolution should be kept")
+	}
+	expr, _ = ParseQuery("a & @" + filepath.Join(dir, "missing.txt"))
+	if _, errc := expr.Eval(context.Background(), fg, MemoryEngine{}); WaitErrors(errc) == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// failingResolver fails to resolve any screen name with its error
+type failingResolver struct {
+	err error
+}
+
+func (r failingResolver) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	return nil, r.err
+}
@@ -0,0 +1,135 @@
+package twitterintersection
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth1Signer signs requests with the OAuth 1.0a HMAC-SHA1 method on behalf
+// of the user that owns the access token.
+type OAuth1Signer struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	Token          string
+	TokenSecret    string
+
+	// used to generate the nonce and timestamp of the requests, replaced
+	// by tests
+	nonce func() string
+	now   func() time.Time
+}
+
+func NewOAuth1Signer(consumerKey, consumerSecret, token, tokenSecret string) *OAuth1Signer {
+	return &OAuth1Signer{consumerKey, consumerSecret, token, tokenSecret, randomNonce, time.Now}
+}
+
+func randomNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// percent encodes s as required by the section 3.6 of the RFC 5849: every
+// bytes but the unreserved characters are encoded.
+func percentEncode(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// returns the normalized request parameters of section 3.4.1.3.2 of the
+// RFC 5849.
+func normalizeParameters(params url.Values) string {
+	pairs := make([][2]string, 0, len(params))
+	for k, values := range params {
+		for _, v := range values {
+			pairs = append(pairs, [2]string{percentEncode(k), percentEncode(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	encoded := make([]string, len(pairs))
+	for i, pair := range pairs {
+		encoded[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// returns the base string URI of section 3.4.1.2 of the RFC 5849.
+func baseStringUri(u *url.URL) string {
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	return scheme + "://" + host + u.EscapedPath()
+}
+
+func signatureBaseString(method string, u *url.URL, params url.Values) string {
+	return strings.ToUpper(method) + "&" + percentEncode(baseStringUri(u)) + "&" + percentEncode(normalizeParameters(params))
+}
+
+func (s *OAuth1Signer) signature(baseString string) string {
+	key := percentEncode(s.ConsumerSecret) + "&" + percentEncode(s.TokenSecret)
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(baseString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *OAuth1Signer) oauthParams() map[string]string {
+	params := map[string]string{
+		"oauth_consumer_key":     s.ConsumerKey,
+		"oauth_nonce":            s.nonce(),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(s.now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	if s.Token != "" {
+		params["oauth_token"] = s.Token
+	}
+	return params
+}
+
+// Sign sets the Authorization header of req.  form holds the parameters of
+// the url-encoded body of the request, if any.
+func (s *OAuth1Signer) Sign(req *http.Request, form url.Values) {
+	oauthParams := s.oauthParams()
+	params := req.URL.Query()
+	for k, values := range form {
+		params[k] = append(params[k], values...)
+	}
+	for k, v := range oauthParams {
+		params.Add(k, v)
+	}
+	oauthParams["oauth_signature"] = s.signature(signatureBaseString(req.Method, req.URL, params))
+
+	header := make([]string, 0, len(oauthParams))
+	for k, v := range oauthParams {
+		header = append(header, percentEncode(k)+`="`+percentEncode(v)+`"`)
+	}
+	sort.Strings(header)
+	req.Header.Set("Authorization", "OAuth "+strings.Join(header, ", "))
+}
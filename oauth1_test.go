@@ -0,0 +1,148 @@
+package twitterintersection
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(consumerKey, consumerSecret, token, tokenSecret, nonce string, timestamp int64) *OAuth1Signer {
+	s := NewOAuth1Signer(consumerKey, consumerSecret, token, tokenSecret)
+	s.nonce = func() string { return nonce }
+	s.now = func() time.Time { return time.Unix(timestamp, 0) }
+	return s
+}
+
+// parses the parameters of an OAuth Authorization header
+func parseOAuthHeader(t *testing.T, header string) map[string]string {
+	if !strings.HasPrefix(header, "OAuth ") {
+		t.Fatal("bad authorization header", header)
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+		kv := strings.SplitN(param, "=", 2)
+		v, err := url.PathUnescape(strings.Trim(kv[1], `"`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		params[kv[0]] = v
+	}
+	return params
+}
+
+func TestPercentEncode(t *testing.T) {
+	encoded := map[string]string{
+		"Ladies + Gentlemen": "Ladies%20%2B%20Gentlemen",
+		"An encoded string!": "An%20encoded%20string%21",
+		"Dogs, Cats & Mice":  "Dogs%2C%20Cats%20%26%20Mice",
+		"☃":                  "%E2%98%83",
+		"-._~":               "-._~",
+	}
+	for s, expt := range encoded {
+		if e := percentEncode(s); e != expt {
+			t.Error("expected", expt, "but received", e)
+		}
+	}
+}
+
+// example of the section 3.4.1.3 of the RFC 5849
+func TestNormalizeParameters(t *testing.T) {
+	params := url.Values{
+		"b5":                     {"=%3D"},
+		"a3":                     {"a", "2 q"},
+		"c@":                     {""},
+		"a2":                     {"r b"},
+		"oauth_consumer_key":     {"9djdj82h48djs9d2"},
+		"oauth_token":            {"kkk9d7dh3k39sjv7"},
+		"oauth_signature_method": {"HMAC-SHA1"},
+		"oauth_timestamp":        {"137131201"},
+		"oauth_nonce":            {"7d8f3e4a"},
+		"c2":                     {""},
+	}
+	expt := "a2=r%20b&a3=2%20q&a3=a&b5=%3D%253D&c%40=&c2=&oauth_consumer_key=9djdj82h48djs9d2&oauth_nonce=7d8f3e4a&oauth_signature_method=HMAC-SHA1&oauth_timestamp=137131201&oauth_token=kkk9d7dh3k39sjv7"
+	if s := normalizeParameters(params); s != expt {
+		t.Error("expected", expt, "\nbut received", s)
+	}
+}
+
+// example of the appendix A.5 of the OAuth Core 1.0 specification
+func TestSignatureBaseStringAndSignature(t *testing.T) {
+	s := newTestSigner("dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00", "kllo9940pd9333jh", 1191242096)
+	req, _ := http.NewRequest("GET", "http://photos.example.net:80/photos?file=vacation.jpg&size=original", nil)
+	params := req.URL.Query()
+	for k, v := range s.oauthParams() {
+		params.Set(k, v)
+	}
+	baseString := signatureBaseString(req.Method, req.URL, params)
+	expt := "GET&http%3A%2F%2Fphotos.example.net%2Fphotos&file%3Dvacation.jpg%26oauth_consumer_key%3Ddpf43f3p2l4k3l03%26oauth_nonce%3Dkllo9940pd9333jh%26oauth_signature_method%3DHMAC-SHA1%26oauth_timestamp%3D1191242096%26oauth_token%3Dnnch734d00sl2jdk%26oauth_version%3D1.0%26size%3Doriginal"
+	if baseString != expt {
+		t.Error("expected", expt, "\nbut received", baseString)
+	}
+	if sig := s.signature(baseString); sig != "tR3+Ty81lMeYAr/Fid0kMTYa/WM=" {
+		t.Error("bad signature", sig)
+	}
+}
+
+// example of the twitter documentation on how to create a signature
+func TestSign(t *testing.T) {
+	s := newTestSigner("xvz1evFS4wEEPTGEFPHBog", "kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+		"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+		"kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", 1318622958)
+	body := "status=Hello%20Ladies%20%2b%20Gentlemen%2c%20a%20signed%20OAuth%20request%21"
+	req, _ := http.NewRequest("POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true", strings.NewReader(body))
+	form, _ := url.ParseQuery(body)
+	s.Sign(req, form)
+	params := parseOAuthHeader(t, req.Header.Get("Authorization"))
+	if sig := params["oauth_signature"]; sig != "hCtSmYh+iHYCEqBWrE7C7hYmtUk=" {
+		t.Error("bad signature", sig)
+	}
+	if token := params["oauth_token"]; token != "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb" {
+		t.Error("bad token", token)
+	}
+}
+
+func TestGetAndPostInUserContext(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := parseOAuthHeader(t, r.Header.Get("Authorization"))
+		if params["oauth_consumer_key"] != "dpf43f3p2l4k3l03" || params["oauth_token"] != "nnch734d00sl2jdk" {
+			t.Error("bad oauth parameters", params)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		u, _ := url.Parse(ts.URL + r.URL.RequestURI())
+		signed := u.Query()
+		for k, v := range form {
+			signed[k] = append(signed[k], v...)
+		}
+		for k, v := range params {
+			if k != "oauth_signature" {
+				signed.Set(k, v)
+			}
+		}
+		s := NewOAuth1Signer("dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00")
+		if sig := s.signature(signatureBaseString(r.Method, u, signed)); sig != params["oauth_signature"] {
+			t.Error("bad signature", params["oauth_signature"], "expected", sig)
+		}
+		fmt.Fprint(w, `{"foo": "bar"}`)
+	}))
+	defer ts.Close()
+	s := newTestSigner("dpf43f3p2l4k3l03", "kd94hf93k423kf44", "nnch734d00sl2jdk", "pfkkdhi9sl3r4s00", "kllo9940pd9333jh", 1191242096)
+	tw := NewUserContextTwitterApi(ts.URL, s)
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/photos", map[string]string{"file": "vacation.jpg", "size": "original"}, &m); err != nil {
+		t.Error(err)
+	} else if m["foo"] != "bar" {
+		t.Fail()
+	}
+	if err := tw.PostAndDeserialize(context.Background(), "/users/lookup.json", map[string]string{"user_id": "1,2"}, &m); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,144 @@
+package twitterintersection
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures the http client of a TwitterApi, or of the requests of
+// RequestBearerToken and InvalidateBearerToken, and the retries of a
+// TwitterApi.
+type Option func(o *options)
+
+type options struct {
+	client    *http.Client
+	transport http.RoundTripper
+	timeout   time.Duration
+	proxy     *url.URL
+	userAgent string
+	retry     *RetryPolicy
+
+	apiUrl, oauth2Url          string
+	idsPageSize, usersPageSize int
+	maxWait                    time.Duration
+}
+
+// WithHTTPClient sends the requests with client instead of
+// http.DefaultClient.  client is not modified by the other options.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithTransport sends the requests through transport, for instance to
+// record them in tests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithTimeout gives up a request, the reading of its response included,
+// after timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithProxy sends the requests through a proxy, http://host:port or
+// socks5://host:port.  It has no effect on a transport, given to
+// WithTransport or WithHTTPClient, that is not an *http.Transport.
+func WithProxy(proxy *url.URL) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithRetryPolicy sends again the requests failing with a transient error
+// according to policy instead of the default policy.  A nil policy disables
+// the retries.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithBaseURLs sends the requests of NewTwitterApiFromCredentials and
+// NewFollowerGetterFromCredentials to apiUrl and oauth2Url instead of
+// TWITTER_API_URL and TWITTER_OAUTH2_URL, for instance to a mock or a
+// gateway.
+func WithBaseURLs(apiUrl, oauth2Url string) Option {
+	return func(o *options) {
+		o.apiUrl = apiUrl
+		o.oauth2Url = oauth2Url
+	}
+}
+
+// WithPageSizes sets the number of ids, and of users, requested per page.
+// twitter does not return more than 5000 ids and 200 users per page.
+func WithPageSizes(ids, users int) Option {
+	return func(o *options) {
+		o.idsPageSize = ids
+		o.usersPageSize = users
+	}
+}
+
+// WithRateLimitMaxWait fails the requests that would wait more than maxWait
+// for the reset of a rate limit instead of holding them.  Zero waits as long
+// as needed.
+func WithRateLimitMaxWait(maxWait time.Duration) Option {
+	return func(o *options) {
+		o.maxWait = maxWait
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		client:        http.DefaultClient,
+		retry:         NewDefaultRetryPolicy(),
+		apiUrl:        TWITTER_API_URL,
+		oauth2Url:     TWITTER_OAUTH2_URL,
+		idsPageSize:   DEFAULT_IDS_PAGE_SIZE,
+		usersPageSize: DEFAULT_USERS_PAGE_SIZE,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// returns the http client described by the options, http.DefaultClient or
+// the client of WithHTTPClient when no other option changes it
+func (o *options) httpClient() *http.Client {
+	if o.transport == nil && o.proxy == nil && o.timeout == 0 {
+		return o.client
+	}
+	client := *o.client
+	if o.transport != nil {
+		client.Transport = o.transport
+	}
+	if o.proxy != nil {
+		if client.Transport == nil {
+			client.Transport = http.DefaultTransport
+		}
+		if transport, ok := client.Transport.(*http.Transport); ok {
+			transport = transport.Clone()
+			transport.Proxy = http.ProxyURL(o.proxy)
+			client.Transport = transport
+		}
+	}
+	if o.timeout > 0 {
+		client.Timeout = o.timeout
+	}
+	return &client
+}
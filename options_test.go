@@ -0,0 +1,121 @@
+package twitterintersection
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport records the requests and answers them with body
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	body     string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.mu.Unlock()
+	return &http.Response{
+		StatusCode: 200,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestWithTransportAndUserAgent(t *testing.T) {
+	transport := &recordingTransport{body: `{"ids": [1492], "next_cursor_str": "0"}`}
+	tw := NewTwitterApi("https://api.example.com/1.1", "access_token", WithTransport(transport), WithUserAgent("bob/1.0"))
+
+	if followers, err := tw.FetchIds(context.Background(), Followers, "bobLeChef", "-1"); err != nil {
+		t.Fatal(err)
+	} else if len(followers.Followers) != 1 || followers.Followers[0] != 1492 {
+		t.Error("bad followers", followers.Followers)
+	}
+	if len(transport.requests) != 1 {
+		t.Fatal("expected a request", transport.requests)
+	}
+	req := transport.requests[0]
+	if u := req.URL.String(); u != "https://api.example.com/1.1/followers/ids.json?count=5000&cursor=-1&screen_name=bobLeChef" {
+		t.Error("bad url", u)
+	}
+	if ua := req.Header.Get("User-Agent"); ua != "bob/1.0" {
+		t.Error("bad user agent", ua)
+	}
+	if auth := req.Header.Get("Authorization"); auth != "Bearer access_token" {
+		t.Error("bad authorization", auth)
+	}
+}
+
+func TestOptionsDoNotModifyTheClient(t *testing.T) {
+	if tw := NewTwitterApi("", ""); tw.Client != http.DefaultClient {
+		t.Error("http.DefaultClient should be used by default")
+	}
+	client := &http.Client{}
+	if tw := NewTwitterApi("", "", WithHTTPClient(client)); tw.Client != client {
+		t.Error("the client should be used as is")
+	}
+	tw := NewTwitterApi("", "", WithHTTPClient(client), WithTimeout(time.Second))
+	if tw.Client.Timeout != time.Second {
+		t.Error("bad timeout", tw.Client.Timeout)
+	}
+	if client.Timeout != 0 {
+		t.Error("the client should not be modified")
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	proxy, _ := url.Parse("socks5://localhost:1080")
+	tw := NewTwitterApi("", "", WithProxy(proxy))
+	transport, ok := tw.Client.Transport.(*http.Transport)
+	if !ok || transport == http.DefaultTransport {
+		t.Fatal("expected a copy of the default transport", tw.Client.Transport)
+	}
+	req, _ := http.NewRequest("GET", "https://api.twitter.com/1.1", nil)
+	if u, err := transport.Proxy(req); err != nil || u.String() != "socks5://localhost:1080" {
+		t.Error("bad proxy", u, err)
+	}
+
+	recording := new(recordingTransport)
+	if tw := NewTwitterApi("", "", WithTransport(recording), WithProxy(proxy)); tw.Client.Transport != recording {
+		t.Error("a custom transport should be kept", tw.Client.Transport)
+	}
+}
+
+func TestRequestBearerTokenWithOptions(t *testing.T) {
+	transport := &recordingTransport{body: `{"token_type":"bearer","access_token":"AAAA"}`}
+	credentials := &Credentials{ConsumerKey: "key", ConsumerSecret: "secret"}
+	if token, err := RequestBearerToken(context.Background(), TWITTER_OAUTH2_URL, credentials, WithTransport(transport), WithUserAgent("bob/1.0")); err != nil || token != "AAAA" {
+		t.Error("bad token", token, err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0].Header.Get("User-Agent") != "bob/1.0" {
+		t.Error("the request should go through the transport", transport.requests)
+	}
+}
+
+func TestWithBaseURLsAndPageSizes(t *testing.T) {
+	transport := &recordingTransport{body: `{"token_type":"bearer","access_token":"AAAA"}`}
+	credentials := &Credentials{ConsumerKey: "key", ConsumerSecret: "secret"}
+	tw, err := NewTwitterApiFromCredentials(context.Background(), credentials, WithTransport(transport),
+		WithBaseURLs("https://gateway.example.com/1.1", "https://gateway.example.com/oauth2"), WithPageSizes(1000, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0].URL.String() != "https://gateway.example.com/oauth2/token" {
+		t.Error("the token should be requested to the gateway", transport.requests)
+	}
+	transport.body = `{"ids": [1492], "next_cursor_str": "0"}`
+	if _, err := tw.FetchIds(context.Background(), Followers, "bobLeChef", "-1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := transport.requests[1].URL.String(); u != "https://gateway.example.com/1.1/followers/ids.json?count=1000&cursor=-1&screen_name=bobLeChef" {
+		t.Error("bad url", u)
+	}
+}
@@ -0,0 +1,137 @@
+package twitterintersection
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// the formats supported by NewUserWriter
+var OutputFormats = []string{"text", "json", "ndjson", "csv", "tsv"}
+
+// the columns of the csv and tsv formats
+var userColumns = []string{"id", "screen_name", "name", "followers_count", "friends_count", "created_at", "verified", "protected", "location"}
+
+// UserWriter writes users in some output format.  Close must be called
+// after the last user to complete the output.
+type UserWriter interface {
+	Write(user *User) error
+	Close() error
+}
+
+// NewUserWriter returns a UserWriter for one of the OutputFormats.
+func NewUserWriter(format string, w io.Writer) (UserWriter, error) {
+	switch format {
+	case "text":
+		return &textUserWriter{w}, nil
+	case "json":
+		return &jsonUserWriter{w: w}, nil
+	case "ndjson":
+		return &ndjsonUserWriter{json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvUserWriter{w: csv.NewWriter(w)}, nil
+	case "tsv":
+		cw := csv.NewWriter(w)
+		cw.Comma = '\t'
+		return &csvUserWriter{w: cw}, nil
+	}
+	return nil, errors.New("unknown output format " + format)
+}
+
+// writes the screen name of the users, or their id when it is unknown
+type textUserWriter struct {
+	w io.Writer
+}
+
+func (t *textUserWriter) Write(user *User) error {
+	if user.ScreenName == "" {
+		_, err := fmt.Fprintln(t.w, user.Id)
+		return err
+	}
+	_, err := fmt.Fprintln(t.w, user.ScreenName)
+	return err
+}
+
+func (t *textUserWriter) Close() error {
+	return nil
+}
+
+// writes a json array of users
+type jsonUserWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonUserWriter) Write(user *User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "[\n"
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%v%s", sep, data)
+	return err
+}
+
+func (j *jsonUserWriter) Close() error {
+	if j.count == 0 {
+		_, err := fmt.Fprintln(j.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(j.w, "\n]")
+	return err
+}
+
+// writes a json object per line
+type ndjsonUserWriter struct {
+	e *json.Encoder
+}
+
+func (n *ndjsonUserWriter) Write(user *User) error {
+	return n.e.Encode(user)
+}
+
+func (n *ndjsonUserWriter) Close() error {
+	return nil
+}
+
+// writes a header row then a row per user
+type csvUserWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvUserWriter) Write(user *User) error {
+	if !c.headerWritten {
+		c.headerWritten = true
+		if err := c.w.Write(userColumns); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		strconv.FormatUint(user.Id, 10),
+		user.ScreenName,
+		user.Name,
+		strconv.Itoa(user.FollowersCount),
+		strconv.Itoa(user.FriendsCount),
+		user.CreatedAt,
+		strconv.FormatBool(user.Verified),
+		strconv.FormatBool(user.Protected),
+		user.Location,
+	})
+}
+
+func (c *csvUserWriter) Close() error {
+	if !c.headerWritten {
+		c.headerWritten = true
+		c.w.Write(userColumns)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
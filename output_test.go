@@ -0,0 +1,66 @@
+package twitterintersection
+
+import (
+	"bytes"
+	"testing"
+)
+
+var outputTestUsers = []*User{
+	{6253282, "twitterapi", "Twitter API", 6133636, 12, "Wed May 23 06:01:13 +0000 2007", true, false, "San Francisco, CA"},
+	{Id: 1492},
+}
+
+func writeUsers(t *testing.T, format string, users []*User) string {
+	buf := new(bytes.Buffer)
+	w, err := NewUserWriter(format, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if err := w.Write(user); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	return buf.String()
+}
+
+func TestUserWriters(t *testing.T) {
+	expected := map[string]string{
+		"text": "twitterapi\n1492\n",
+		"json": `[
+{"id":6253282,"screen_name":"twitterapi","name":"Twitter API","followers_count":6133636,"friends_count":12,"created_at":"Wed May 23 06:01:13 +0000 2007","verified":true,"protected":false,"location":"San Francisco, CA"},
+{"id":1492,"screen_name":"","name":"","followers_count":0,"friends_count":0,"created_at":"","verified":false,"protected":false,"location":""}
+]
+`,
+		"ndjson": `{"id":6253282,"screen_name":"twitterapi","name":"Twitter API","followers_count":6133636,"friends_count":12,"created_at":"Wed May 23 06:01:13 +0000 2007","verified":true,"protected":false,"location":"San Francisco, CA"}
+{"id":1492,"screen_name":"","name":"","followers_count":0,"friends_count":0,"created_at":"","verified":false,"protected":false,"location":""}
+`,
+		"csv": `id,screen_name,name,followers_count,friends_count,created_at,verified,protected,location
+6253282,twitterapi,Twitter API,6133636,12,Wed May 23 06:01:13 +0000 2007,true,false,"San Francisco, CA"
+1492,,,0,0,,false,false,
+`,
+		"tsv": "id\tscreen_name\tname\tfollowers_count\tfriends_count\tcreated_at\tverified\tprotected\tlocation\n" +
+			"6253282\ttwitterapi\tTwitter API\t6133636\t12\tWed May 23 06:01:13 +0000 2007\ttrue\tfalse\tSan Francisco, CA\n" +
+			"1492\t\t\t0\t0\t\tfalse\tfalse\t\n",
+	}
+	for _, format := range OutputFormats {
+		if out := writeUsers(t, format, outputTestUsers); out != expected[format] {
+			t.Errorf("bad %v output:\n%v", format, out)
+		}
+	}
+}
+
+func TestUserWritersWithoutUsers(t *testing.T) {
+	if out := writeUsers(t, "json", nil); out != "[]\n" {
+		t.Error("bad empty json output", out)
+	}
+	if out := writeUsers(t, "csv", nil); out != "id,screen_name,name,followers_count,friends_count,created_at,verified,protected,location\n" {
+		t.Error("bad empty csv output", out)
+	}
+	if _, err := NewUserWriter("xml", new(bytes.Buffer)); err == nil {
+		t.Error("xml is not supported")
+	}
+}
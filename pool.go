@@ -0,0 +1,161 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoTokenLeft = errors.New("every token of the pool has been rejected by twitter")
+
+// TokenPool is a FollowerGetter that spreads its requests over many
+// TwitterApi, each with its own credentials and rate limits.  A TwitterApi
+// whose token is rejected by twitter is taken out of the pool.
+type TokenPool struct {
+	mu   sync.Mutex
+	apis []*TwitterApi
+	next int
+}
+
+func NewTokenPool(apis ...*TwitterApi) *TokenPool {
+	return &TokenPool{apis: apis}
+}
+
+// Len returns the number of TwitterApi still in rotation.
+func (p *TokenPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.apis)
+}
+
+// the budget given by a TokenPool to the requests of the TwitterApi it
+// picked, carried by their context
+type poolBudget struct {
+	// true until the request reserved by pick is sent
+	reserved atomic.Bool
+}
+
+type poolBudgetKey struct{}
+
+// returns the budget given by a TokenPool to the requests of ctx, or nil
+// when they are not sent by a pool
+func poolBudgetOf(ctx context.Context) *poolBudget {
+	budget, _ := ctx.Value(poolBudgetKey{}).(*poolBudget)
+	return budget
+}
+
+// returns the TwitterApi that should send the next request of endpoint: the
+// next one, in round robin, that has some budget left, in which case the
+// request is reserved, or, when all the budgets are exhausted, the one whose
+// budget is reset first.
+func (p *TokenPool) pick(endpoint string) (api *TwitterApi, reserved bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.apis) == 0 {
+		return nil, false, ErrNoTokenLeft
+	}
+	var first *TwitterApi
+	var firstReset time.Time
+	for i := 0; i < len(p.apis); i++ {
+		api := p.apis[(p.next+i)%len(p.apis)]
+		if ok, reset := api.RateLimits.Reserve(endpoint); ok {
+			p.next = (p.next + i + 1) % len(p.apis)
+			return api, true, nil
+		} else if first == nil || reset.Before(firstReset) {
+			first, firstReset = api, reset
+		}
+	}
+	return first, false, nil
+}
+
+func (p *TokenPool) remove(api *TwitterApi) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, a := range p.apis {
+		if a == api {
+			p.apis = append(p.apis[:i], p.apis[i+1:]...)
+			log.Printf("token rejected by twitter, %v token(s) left in the pool", len(p.apis))
+			return
+		}
+	}
+}
+
+// calls f with the TwitterApi picked for endpoint, and again with another
+// one while the token is rejected as invalid or its budget is exhausted.
+func (p *TokenPool) do(ctx context.Context, endpoint string, f func(ctx context.Context, api *TwitterApi) error) error {
+	for {
+		api, reserved, err := p.pick(endpoint)
+		if err != nil {
+			return err
+		}
+		budget := new(poolBudget)
+		budget.reserved.Store(reserved)
+		err = f(context.WithValue(ctx, poolBudgetKey{}, budget), api)
+		if IsInvalidToken(err) {
+			p.remove(api)
+			continue
+		} else if IsRateLimited(err) && api.RateLimits != nil {
+			// the budget of api is recorded as exhausted, the next pick
+			// takes another token or waits for the first reset
+			continue
+		}
+		return err
+	}
+}
+
+func (p *TokenPool) GetUsersByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerList {
+	followerListC := make(chan *FollowerList)
+	go func() {
+		var followers *FollowerList
+		err := p.do(ctx, "/"+string(relation)+"/list.json", func(ctx context.Context, api *TwitterApi) (err error) {
+			followers, err = api.FetchUsers(ctx, relation, screenName, cursor)
+			return err
+		})
+		if err != nil {
+			followers = &FollowerList{Err: err}
+		}
+		followerListC <- followers
+	}()
+	return followerListC
+}
+
+func (p *TokenPool) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	followerListC := make(chan *FollowerIDList)
+	go func() {
+		var followers *FollowerIDList
+		err := p.do(ctx, "/"+string(relation)+"/ids.json", func(ctx context.Context, api *TwitterApi) (err error) {
+			followers, err = api.FetchIds(ctx, relation, screenName, cursor)
+			return err
+		})
+		if err != nil {
+			followers = &FollowerIDList{Err: err}
+		}
+		followerListC <- followers
+	}()
+	return followerListC
+}
+
+func (p *TokenPool) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	lookupC := make(chan *UserLookup)
+	go func() {
+		var users map[uint64]*User
+		err := p.do(ctx, "/users/lookup.json", func(ctx context.Context, api *TwitterApi) (err error) {
+			users, err = api.HydrateUsers(ctx, ids)
+			return err
+		})
+		sendLookups(ctx, lookupC, ids, users, err)
+	}()
+	return lookupC
+}
+
+func (p *TokenPool) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	var ids map[string]uint64
+	err := p.do(ctx, "/users/lookup.json", func(ctx context.Context, api *TwitterApi) (err error) {
+		ids, err = api.ResolveScreenNames(ctx, screenNames)
+		return err
+	})
+	return ids, err
+}
@@ -0,0 +1,137 @@
+package twitterintersection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenPoolPick(t *testing.T) {
+	api1, api2, api3 := NewTwitterApi("", "token1"), NewTwitterApi("", "token2"), NewTwitterApi("", "token3")
+	p := NewTokenPool(api1, api2, api3)
+	for _, expt := range []*TwitterApi{api1, api2, api3, api1} {
+		if api, _, err := p.pick("/followers/ids.json"); err != nil || api != expt {
+			t.Error("bad round robin", api.AccessToken, err)
+		}
+	}
+
+	now := time.Now()
+	api1.RateLimits.Update("/followers/ids.json", rateLimitHeader(15, 0, now.Add(10*time.Minute)))
+	api2.RateLimits.Update("/followers/ids.json", rateLimitHeader(15, 0, now.Add(5*time.Minute)))
+	api3.RateLimits.Update("/followers/ids.json", rateLimitHeader(15, 4, now.Add(5*time.Minute)))
+	for i := 0; i < 4; i++ {
+		if api, reserved, _ := p.pick("/followers/ids.json"); api != api3 || !reserved {
+			t.Error("should pick the token with some budget left", api.AccessToken, reserved)
+		}
+	}
+	if api, _, _ := p.pick("/friends/ids.json"); api == api3 {
+		t.Error("the budgets of other endpoints are independent")
+	}
+
+	// the budget of api3 is reserved by the picks
+	if remaining, _, _ := api3.RateLimits.Remaining("/followers/ids.json"); remaining != 0 {
+		t.Error("the picks should reserve the budget of api3", remaining)
+	}
+	if api, reserved, _ := p.pick("/followers/ids.json"); api != api2 || reserved {
+		t.Error("should pick the token reset first, without budget", api.AccessToken, reserved)
+	}
+}
+
+func TestTokenPoolSwitchesTokenOnRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	tokens := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens[r.Header.Get("Authorization")]++
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "Bearer exhausted" {
+			for k, v := range rateLimitHeader(15, 0, time.Now().Add(15*time.Minute)) {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(429)
+			fmt.Fprint(w, `{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"ids": [1, 2], "next_cursor_str": "0"}`)
+	}))
+	defer ts.Close()
+	exhausted := NewTwitterApi(ts.URL, "exhausted")
+	p := NewTokenPool(exhausted, NewTwitterApi(ts.URL, "valid"))
+
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), p, "bobLeChef")); !reflect.DeepEqual(ids, []uint64{1, 2}) {
+		t.Error("bad ids", ids)
+	}
+	if tokens["Bearer exhausted"] != 1 || tokens["Bearer valid"] != 1 {
+		t.Error("the request should be sent again with the other token", tokens)
+	}
+	if remaining, _, known := exhausted.RateLimits.Remaining("/followers/ids.json"); !known || remaining != 0 {
+		t.Error("the budget of the token should be exhausted", remaining, known)
+	}
+	if p.Len() != 2 {
+		t.Error("a rate limited token stays in the pool")
+	}
+}
+
+func TestTokenPoolRemovesRejectedTokens(t *testing.T) {
+	var mu sync.Mutex
+	tokens := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens[r.Header.Get("Authorization")]++
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "Bearer revoked" {
+			w.WriteHeader(401)
+			fmt.Fprint(w, `{"errors":[{"code":89,"message":"Invalid or expired token."}]}`)
+			return
+		}
+		switch r.URL.Query().Get("cursor") {
+		case "-1":
+			fmt.Fprint(w, `{"ids": [1, 2], "next_cursor_str": "1"}`)
+		case "1":
+			fmt.Fprint(w, `{"ids": [3], "next_cursor_str": "0"}`)
+		}
+	}))
+	defer ts.Close()
+	p := NewTokenPool(NewTwitterApi(ts.URL, "revoked"), NewTwitterApi(ts.URL, "valid"))
+
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), p, "bobLeChef")); !reflect.DeepEqual(ids, []uint64{1, 2, 3}) {
+		t.Error("bad ids", ids)
+	}
+	if p.Len() != 1 {
+		t.Error("the revoked token should be out of the pool")
+	}
+	if tokens["Bearer revoked"] != 1 || tokens["Bearer valid"] != 2 {
+		t.Error("bad spreading of the requests", tokens)
+	}
+}
+
+func TestTokenPoolWithoutToken(t *testing.T) {
+	p := NewTokenPool()
+	if followers := <-p.GetIdsByCursor(context.Background(), Followers, "bobLeChef", "-1"); followers.Err != ErrNoTokenLeft {
+		t.Error("there is no token to get the followers", followers.Err)
+	}
+	if err := p.do(context.Background(), "/followers/ids.json", func(context.Context, *TwitterApi) error { return nil }); err != ErrNoTokenLeft {
+		t.Error("bad error", err)
+	}
+}
+
+func TestTokenPoolKeepsTokensOnProtectedAccounts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+		fmt.Fprint(w, `{"request":"/1.1/followers/ids.json","error":"Not authorized."}`)
+	}))
+	defer ts.Close()
+	p := NewTokenPool(NewTwitterApi(ts.URL, "a"), NewTwitterApi(ts.URL, "b"))
+
+	if followers := <-p.GetIdsByCursor(context.Background(), Followers, "secret", "-1"); followers.Err == nil {
+		t.Error("expected an error")
+	}
+	if p.Len() != 2 {
+		t.Error("the tokens are not the cause of the error", p.Len())
+	}
+}
@@ -0,0 +1,350 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a set expression over the followers or friends of twitter
+// accounts, as parsed by ParseQuery.
+//
+// The grammar of a query is
+//
+//	expr    := term { ("|" | "-" | "^") term }
+//	term    := factor { "&" factor }
+//	factor  := account | list | "(" expr ")" | "atleast" "(" number "," expr { "," expr } ")"
+//	account := [ relation ":" ] ( screen name | "id:" user id )
+//	list    := "@" path [ "#" column ] | "-"
+//
+// where "&" is the intersection, "|" the union, "-" the difference and "^"
+// the symmetric difference.  atleast(k, ...) selects the users present in at
+// least k of its operands.
+//
+// A screen name is made of letters, digits and underscores, its case does
+// not matter.  An account can also be given by the id of its user, which
+// does not change when the user is renamed.  The optional relation, either
+// "followers" or "friends", selects which users of the account are part of
+// the set.  Without relation, the followers are used.
+//
+// A list is a file of ids and screen names, or a column of a csv file, and
+// "-" is the list read on the standard input.  A path runs until a space or
+// one of "()&|^,", so a difference with a list needs spaces around the "-".
+// See ListExpr.
+type Expr interface {
+	// Eval returns the ids of the users described by the expression, without
+	// repetitions, and the errors met while fetching its accounts.  The ids
+	// are complete only if no error is received.  The set operations are
+	// computed by engine and the evaluation stops when ctx is done.
+	Eval(ctx context.Context, followerGetter FollowerGetter, engine SetEngine) (<-chan uint64, <-chan error)
+	String() string
+}
+
+// AccountExpr is an operand of a query, the users in relation with an
+// account given by its screen name, in lower case, or by its user id.
+type AccountExpr struct {
+	Relation   Relation
+	ScreenName string
+	// the id of the user, zero until the screen name is resolved
+	Id uint64
+}
+
+// ParseAccount parses an operand such as "alice", "friends:alice" or
+// "id:12345".  Without relation, the followers of the account are used.
+func ParseAccount(operand string) (*AccountExpr, error) {
+	relation, account := Followers, operand
+	if i := strings.Index(operand, ":"); i >= 0 && !strings.HasPrefix(operand, idAccountPrefix) {
+		var err error
+		if relation, err = ParseRelation(operand[:i]); err != nil {
+			return nil, err
+		}
+		account = operand[i+1:]
+	}
+	if strings.HasPrefix(account, idAccountPrefix) {
+		id, ok := AccountId(account)
+		if !ok {
+			return nil, errors.New("bad account " + operand)
+		}
+		return &AccountExpr{Relation: relation, Id: id}, nil
+	} else if account == "" || strings.Contains(account, ":") {
+		return nil, errors.New("bad account " + operand)
+	}
+	return &AccountExpr{Relation: relation, ScreenName: strings.ToLower(account)}, nil
+}
+
+// Account returns the account to fetch: the IdAccount of the user once the
+// id is known, the screen name otherwise.
+func (e *AccountExpr) Account() string {
+	if e.Id != 0 {
+		return IdAccount(e.Id)
+	}
+	return e.ScreenName
+}
+
+// Eval returns the users in relation with the account.  Its errors name
+// the account by its screen name, even once it is resolved.
+func (e *AccountExpr) Eval(ctx context.Context, followerGetter FollowerGetter, engine SetEngine) (<-chan uint64, <-chan error) {
+	name := e.ScreenName
+	if name == "" {
+		name = e.Account()
+	}
+	return getIds(ctx, followerGetter, e.Relation, e.Account(), name)
+}
+
+func (e *AccountExpr) String() string {
+	name := e.ScreenName
+	if name == "" {
+		name = IdAccount(e.Id)
+	}
+	if e.Relation == Followers {
+		return name
+	}
+	return string(e.Relation) + ":" + name
+}
+
+type binaryExpr struct {
+	op          rune
+	left, right Expr
+}
+
+func (e *binaryExpr) Eval(ctx context.Context, followerGetter FollowerGetter, engine SetEngine) (<-chan uint64, <-chan error) {
+	left, leftErrc := e.left.Eval(ctx, followerGetter, engine)
+	right, rightErrc := e.right.Eval(ctx, followerGetter, engine)
+	var ids <-chan uint64
+	var errc <-chan error
+	switch e.op {
+	case '&':
+		ids, errc = engine.AtLeast(ctx, 2, left, right)
+	case '|':
+		ids, errc = engine.AtLeast(ctx, 1, left, right)
+	case '-':
+		ids, errc = engine.Difference(ctx, left, right)
+	case '^':
+		ids, errc = engine.SymmetricDifference(ctx, left, right)
+	default:
+		panic("unknown operator " + string(e.op))
+	}
+	return ids, mergeErrors(leftErrc, rightErrc, errc)
+}
+
+func (e *binaryExpr) String() string {
+	return fmt.Sprintf("(%v %c %v)", e.left, e.op, e.right)
+}
+
+type atLeastExpr struct {
+	k        int
+	operands []Expr
+}
+
+func (e *atLeastExpr) Eval(ctx context.Context, followerGetter FollowerGetter, engine SetEngine) (<-chan uint64, <-chan error) {
+	cs := make([]<-chan uint64, len(e.operands))
+	errcs := make([]<-chan error, len(e.operands)+1)
+	for i, operand := range e.operands {
+		cs[i], errcs[i] = operand.Eval(ctx, followerGetter, engine)
+	}
+	ids, errc := engine.AtLeast(ctx, e.k, cs...)
+	errcs[len(e.operands)] = errc
+	return ids, mergeErrors(errcs...)
+}
+
+func (e *atLeastExpr) String() string {
+	operands := make([]string, len(e.operands))
+	for i, operand := range e.operands {
+		operands[i] = operand.String()
+	}
+	return fmt.Sprintf("atleast(%v, %v)", e.k, strings.Join(operands, ", "))
+}
+
+// QueryAccounts returns the accounts used by expr.
+func QueryAccounts(expr Expr) []*AccountExpr {
+	switch e := expr.(type) {
+	case *AccountExpr:
+		return []*AccountExpr{e}
+	case *binaryExpr:
+		return append(QueryAccounts(e.left), QueryAccounts(e.right)...)
+	case *atLeastExpr:
+		accounts := make([]*AccountExpr, 0)
+		for _, operand := range e.operands {
+			accounts = append(accounts, QueryAccounts(operand)...)
+		}
+		return accounts
+	}
+	return nil
+}
+
+type token struct {
+	value string
+	pos   int
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func tokenize(query string) ([]*token, error) {
+	tokens := make([]*token, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '@':
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("&|^(),", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, &token{string(runes[start:i]), start})
+		case strings.ContainsRune("&|-^(),", r):
+			tokens = append(tokens, &token{string(r), i})
+			i++
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, &token{string(runes[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %v", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []*token
+	pos    int
+	length int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].value
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	position := p.length
+	if p.pos < len(p.tokens) {
+		position = p.tokens[p.pos].pos
+	}
+	return fmt.Errorf("%v at position %v", fmt.Sprintf(format, args...), position)
+}
+
+func (p *parser) expect(value string) error {
+	if p.peek() != value {
+		return p.errorf("expected %q", value)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "|" || op == "-" || op == "^"; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{rune(op[0]), left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{'&', left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseFactor() (Expr, error) {
+	switch value := p.peek(); {
+	case value == "(":
+		p.pos++
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case strings.ToLower(value) == "atleast" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].value == "(":
+		p.pos += 2
+		return p.parseAtLeast()
+	case value != "" && isWordRune([]rune(value)[0]):
+		account, err := ParseAccount(value)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos++
+		return account, nil
+	case strings.HasPrefix(value, "@") || value == "-":
+		list, err := ParseList(value)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos++
+		return list, nil
+	case value == "":
+		return nil, p.errorf("unexpected end of query")
+	default:
+		return nil, p.errorf("unexpected %q", value)
+	}
+}
+
+func (p *parser) parseAtLeast() (Expr, error) {
+	k, err := strconv.Atoi(p.peek())
+	if err != nil || k < 1 {
+		return nil, p.errorf("atleast needs a positive number as first argument")
+	}
+	p.pos++
+	operands := make([]Expr, 0)
+	for p.peek() == "," {
+		p.pos++
+		operand, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if k > len(operands) {
+		return nil, fmt.Errorf("atleast(%v, ...) needs at least %v operands but received %v", k, k, len(operands))
+	}
+	return &atLeastExpr{k, operands}, nil
+}
+
+// ParseQuery parses a set expression such as "(alice & bob) - carol" or
+// "atleast(3, a, b, c, d, e)".  See Expr for the grammar.
+func ParseQuery(query string) (Expr, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens, 0, len([]rune(query))}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return expr, nil
+}
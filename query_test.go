@@ -0,0 +1,136 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// mapFollowerGetter returns, in a single page, the followers of the account
+// listed in the map.  The friends of an account are listed under the key
+// "friends:" followed by the screen name.
+type mapFollowerGetter map[string][]uint64
+
+func (m mapFollowerGetter) GetUsersByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerList {
+	followerListC := make(chan *FollowerList, 1)
+	followerListC <- &FollowerList{NextCursor: "0", Followers: []*User{}}
+	return followerListC
+}
+
+func (m mapFollowerGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	key := screenName
+	if relation != Followers {
+		key = string(relation) + ":" + screenName
+	}
+	followerListC := make(chan *FollowerIDList, 1)
+	followerListC <- &FollowerIDList{NextCursor: "0", Followers: m[key]}
+	return followerListC
+}
+
+func (m mapFollowerGetter) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	ret := make(chan *UserLookup)
+	go func() {
+		for _, id := range ids {
+			if id%100 == 13 {
+				// missing users
+				ret <- &UserLookup{Id: id, User: nil}
+			} else {
+				ret <- &UserLookup{Id: id, User: &User{Id: id, ScreenName: fmt.Sprintf("%v", id)}}
+			}
+		}
+		close(ret)
+	}()
+	return ret
+}
+
+func evalQuery(t *testing.T, query string, followerGetter FollowerGetter, engine SetEngine) []uint64 {
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatal(query, err)
+	}
+	idsC, errc := expr.Eval(context.Background(), followerGetter, engine)
+	ids := readUInt64Channel(idsC)
+	if err := WaitErrors(errc); err != nil {
+		t.Error(query, err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestParseQuery(t *testing.T) {
+	queries := map[string]string{
+		"alice":                         "alice",
+		"alice & bob - carol":           "((alice & bob) - carol)",
+		"alice - bob & carol":           "(alice - (bob & carol))",
+		"(alice | bob) ^ carol":         "((alice | bob) ^ carol)",
+		"atleast(2, a, b & c, d)":       "atleast(2, a, (b & c), d)",
+		" ATLEAST ( 1 , bob_le_chef ) ": "atleast(1, bob_le_chef)",
+		"followers:alice & friends:bob": "(alice & friends:bob)",
+		"FRIENDS:alice":                 "friends:alice",
+		"id:12 & Alice":                 "(id:12 & alice)",
+		"friends:id:12":                 "friends:id:12",
+		"@ids.txt&alice":                "(@ids.txt & alice)",
+		"(@my-list.csv#Handle) - -":     "(@my-list.csv#Handle - -)",
+	}
+	for query, expected := range queries {
+		if expr, err := ParseQuery(query); err != nil {
+			t.Error(query, err)
+		} else if expr.String() != expected {
+			t.Error("expected", expected, "but received", expr.String())
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	queries := []string{"", "alice &", "(alice | bob", "alice bob", "alice % bob", "atleast(3, a, b)", "atleast(0, a)", "atleast(a, b)", ")", "enemies:bob", "friends:", "friends:a:b", "id:bob", "id:0", "friends:id:", "id:12:a", "@", "@ids.csv#", "alice @ids.txt"}
+	for _, query := range queries {
+		if _, err := ParseQuery(query); err == nil {
+			t.Error("expected an error for query", query)
+		}
+	}
+}
+
+func TestEvalQuery(t *testing.T) {
+	fg := mapFollowerGetter{
+		"a":         {1, 2, 3, 4},
+		"friends:a": {4, 5},
+		"b":         {3, 4, 5},
+		"c":         {4, 6},
+		"id:12":     {3, 6},
+	}
+	queries := map[string]string{
+		"a & b":                   "[3 4]",
+		"(a & b) - c":             "[3]",
+		"a | c":                   "[1 2 3 4 6]",
+		"a ^ b":                   "[1 2 5]",
+		"atleast(2, a, b, c)":     "[3 4]",
+		"atleast(3, a, b, c)":     "[4]",
+		"friends:a & b":           "[4 5]",
+		"followers:a - friends:a": "[1 2 3]",
+		"A & id:12":               "[3]",
+	}
+	for query, expected := range queries {
+		if ids := evalQuery(t, query, fg, MemoryEngine{}); fmt.Sprint(ids) != expected {
+			t.Error(query, "expected", expected, "but received", ids)
+		}
+		if ids := evalQuery(t, query, fg, NewDiskEngine(t.TempDir(), 2)); fmt.Sprint(ids) != expected {
+			t.Error(query, "on disk expected", expected, "but received", ids)
+		}
+	}
+}
+
+func TestEvalAccountErrorNamesTheScreenName(t *testing.T) {
+	fg := &failingPagesGetter{MockFollowerGetter{t}, map[string]error{
+		"id:1002": NewTwitterErr(`{"errors":[{"code":50,"message":"User not found."}]}`, 404),
+	}}
+	for _, account := range []*AccountExpr{{Relation: Followers, ScreenName: "alice", Id: 1002}, {Relation: Followers, Id: 1002}} {
+		idsC, errc := account.Eval(context.Background(), fg, MemoryEngine{})
+		readUInt64Channel(idsC)
+		var accountErr *AccountErr
+		if err := WaitErrors(errc); !errors.As(err, &accountErr) || accountErr.ScreenName != account.String() || !IsNotFound(err) {
+			t.Error("the error should name", account, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the window used when twitter reports that a limit is reached without
+// telling when it will be reset
+const DEFAULT_RATE_LIMIT_WINDOW = 15 * time.Minute
+
+// waited after the reset time of a limit to absorb the clock differences
+// with twitter
+const rateLimitResetMargin = time.Second
+
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// RateLimiter keeps the request budget of every endpoint family, as reported
+// by the x-rate-limit headers of the responses of twitter, and holds the
+// callers until the reset of a budget once it is exhausted.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]*rateLimit
+
+	// when not zero, Wait fails instead of waiting longer than MaxWait
+	MaxWait time.Duration
+
+	// replaced by tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{limits: make(map[string]*rateLimit), now: time.Now, sleep: sleepContext}
+}
+
+// sleeps for d, or returns the error of ctx if it is done before
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// returns the endpoint family of an api path, the path without its query
+// and extension, for instance "/followers/ids" for
+// "/followers/ids.json?cursor=-1".  twitter counts the requests per family.
+func endpointFamily(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return strings.TrimSuffix(path, ".json")
+}
+
+func parseRateLimitHeaders(header http.Header) (*rateLimit, bool) {
+	limit, err1 := strconv.Atoi(header.Get("x-rate-limit-limit"))
+	remaining, err2 := strconv.Atoi(header.Get("x-rate-limit-remaining"))
+	reset, err3 := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, false
+	}
+	return &rateLimit{limit, remaining, time.Unix(reset, 0)}, true
+}
+
+// Update records the budget reported by the headers of a response of
+// endpoint.  Responses without rate limit headers are ignored.
+func (l *RateLimiter) Update(endpoint string, header http.Header) {
+	if l == nil {
+		return
+	}
+	limit, ok := parseRateLimitHeaders(header)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[endpointFamily(endpoint)] = limit
+}
+
+// Exhausted records that twitter refused a request of endpoint because of
+// its rate limit.  When the reset time is unknown, the budget is considered
+// reset after DEFAULT_RATE_LIMIT_WINDOW.
+func (l *RateLimiter) Exhausted(endpoint string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	family := endpointFamily(endpoint)
+	limit, ok := l.limits[family]
+	if !ok {
+		limit = new(rateLimit)
+		l.limits[family] = limit
+	}
+	limit.remaining = 0
+	if now := l.now(); !limit.reset.After(now) {
+		limit.reset = now.Add(DEFAULT_RATE_LIMIT_WINDOW)
+	}
+}
+
+// Remaining returns the number of requests left for endpoint before its
+// reset time.  known is false when no response of the endpoint has been
+// received yet or when the reset time is passed.
+func (l *RateLimiter) Remaining(endpoint string) (remaining int, reset time.Time, known bool) {
+	if l == nil {
+		return 0, time.Time{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, ok := l.limits[endpointFamily(endpoint)]
+	if !ok || !limit.reset.After(l.now()) {
+		return 0, time.Time{}, false
+	}
+	return limit.remaining, limit.reset, true
+}
+
+// Reserve reserves a request of endpoint when it can be sent without
+// waiting.  Otherwise it returns false with the reset time of the exhausted
+// budget.
+func (l *RateLimiter) Reserve(endpoint string) (ok bool, reset time.Time) {
+	if l == nil {
+		return true, time.Time{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, known := l.limits[endpointFamily(endpoint)]
+	if !known || !limit.reset.After(l.now()) {
+		// unknown or outdated budget, the response will tell
+		return true, time.Time{}
+	} else if limit.remaining > 0 {
+		limit.remaining--
+		return true, time.Time{}
+	}
+	return false, limit.reset
+}
+
+// Wait blocks until a request of endpoint can be sent without exceeding its
+// budget and reserves that request.  It returns the error of ctx if ctx is
+// done before, or an error if it would wait longer than MaxWait.
+func (l *RateLimiter) Wait(ctx context.Context, endpoint string) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	family := endpointFamily(endpoint)
+	for {
+		ok, reset := l.Reserve(endpoint)
+		if ok {
+			return ctx.Err()
+		}
+		d := reset.Sub(l.now()) + rateLimitResetMargin
+		if l.MaxWait > 0 && d > l.MaxWait {
+			return errors.New("api limit of " + family + " reached until " + reset.Format(time.Kitchen) + ", longer than the maximum wait of " + l.MaxWait.String())
+		}
+		log.Printf("api limit of %v reached, waiting %v until %v", family, d.Round(time.Second), reset.Format(time.Kitchen))
+		if err := l.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package twitterintersection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when something sleeps
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.t = c.t.Add(d)
+	return nil
+}
+
+func newTestRateLimiter(clock *fakeClock) *RateLimiter {
+	l := NewRateLimiter()
+	l.now, l.sleep = clock.now, clock.sleep
+	return l
+}
+
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	h := make(http.Header)
+	h.Set("x-rate-limit-limit", strconv.Itoa(limit))
+	h.Set("x-rate-limit-remaining", strconv.Itoa(remaining))
+	h.Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+	return h
+}
+
+func TestEndpointFamily(t *testing.T) {
+	families := map[string]string{
+		"/followers/ids.json":           "/followers/ids",
+		"/followers/ids.json?cursor=-1": "/followers/ids",
+		"/users/lookup":                 "/users/lookup",
+	}
+	for path, expt := range families {
+		if f := endpointFamily(path); f != expt {
+			t.Error("expected", expt, "but received", f)
+		}
+	}
+}
+
+func TestRateLimiterUpdateAndRemaining(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := newTestRateLimiter(clock)
+	if _, _, known := l.Remaining("/followers/ids.json"); known {
+		t.Error("the budget should be unknown")
+	}
+	l.Update("/followers/ids.json?cursor=-1", rateLimitHeader(15, 7, time.Unix(1900, 0)))
+	l.Update("/followers/ids.json", make(http.Header))
+	if remaining, reset, known := l.Remaining("/followers/ids.json"); !known || remaining != 7 || reset.Unix() != 1900 {
+		t.Error("bad budget", remaining, reset, known)
+	}
+	if _, _, known := l.Remaining("/friends/ids.json"); known {
+		t.Error("the budget of friends should be unknown")
+	}
+	clock.sleep(context.Background(), time.Hour)
+	if _, _, known := l.Remaining("/followers/ids.json"); known {
+		t.Error("the budget should be outdated")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := newTestRateLimiter(clock)
+	l.Wait(context.Background(), "/followers/ids.json")
+	l.Update("/followers/ids.json", rateLimitHeader(15, 2, time.Unix(1600, 0)))
+	l.Wait(context.Background(), "/followers/ids.json")
+	l.Wait(context.Background(), "/followers/ids.json")
+	if len(clock.sleeps) != 0 {
+		t.Error("should not have waited", clock.sleeps)
+	}
+	l.Wait(context.Background(), "/followers/ids.json")
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 600*time.Second+rateLimitResetMargin {
+		t.Error("should have waited until the reset", clock.sleeps)
+	}
+}
+
+func TestRateLimiterWaitIsCancelled(t *testing.T) {
+	l := NewRateLimiter()
+	l.Update("/followers/ids.json", rateLimitHeader(15, 0, time.Now().Add(time.Hour)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "/followers/ids.json"); err != context.DeadlineExceeded {
+		t.Error("the wait should stop with the context", err)
+	}
+}
+
+func TestRateLimiterExhausted(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := newTestRateLimiter(clock)
+	l.Exhausted("/users/lookup.json")
+	if remaining, reset, known := l.Remaining("/users/lookup.json"); !known || remaining != 0 || !reset.Equal(clock.now().Add(DEFAULT_RATE_LIMIT_WINDOW)) {
+		t.Error("bad budget", remaining, reset, known)
+	}
+	l.Update("/followers/ids.json", rateLimitHeader(15, 3, time.Unix(1060, 0)))
+	l.Exhausted("/followers/ids.json")
+	if remaining, reset, _ := l.Remaining("/followers/ids.json"); remaining != 0 || reset.Unix() != 1060 {
+		t.Error("the known reset time should be kept", remaining, reset)
+	}
+}
+
+func TestGetAndDeserializeWaitsForTheRateLimitReset(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		now := clock.now()
+		if calls == 1 {
+			w.Header().Set("x-rate-limit-limit", "15")
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(now.Unix()+120, 10))
+			w.WriteHeader(429)
+			return
+		}
+		fmt.Fprint(w, `{"foo": "bar"}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+	tw.RateLimits = newTestRateLimiter(clock)
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/followers/ids.json", map[string]string{}, &m); err != nil {
+		t.Error(err)
+	} else if m["foo"] != "bar" {
+		t.Fail()
+	}
+	if calls != 2 {
+		t.Error("the request should have been sent twice", calls)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 120*time.Second+rateLimitResetMargin {
+		t.Error("should have waited until the reset", clock.sleeps)
+	}
+}
+
+func TestGetAndDeserializeWaitsOnRateLimitCode(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// the rate limit reported with another status and no headers
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"foo": "bar"}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+	tw.RateLimits = newTestRateLimiter(clock)
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/followers/ids.json", map[string]string{}, &m); err != nil {
+		t.Error(err)
+	} else if m["foo"] != "bar" {
+		t.Fail()
+	}
+	if calls != 2 {
+		t.Error("the request should have been sent twice", calls)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != DEFAULT_RATE_LIMIT_WINDOW+rateLimitResetMargin {
+		t.Error("should have waited for the default window", clock.sleeps)
+	}
+}
+
+func TestRateLimiterMaxWait(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := newTestRateLimiter(clock)
+	l.MaxWait = 5 * time.Minute
+	l.Update("/followers/ids.json", rateLimitHeader(15, 0, time.Unix(1200, 0)))
+	if err := l.Wait(context.Background(), "/followers/ids.json"); err != nil {
+		t.Error("a wait shorter than MaxWait is allowed", err)
+	}
+	l.Update("/followers/ids.json", rateLimitHeader(15, 0, time.Unix(2000, 0)))
+	if err := l.Wait(context.Background(), "/followers/ids.json"); err == nil {
+		t.Error("a wait longer than MaxWait should fail")
+	}
+	if len(clock.sleeps) != 1 {
+		t.Error("should have waited once", clock.sleeps)
+	}
+}
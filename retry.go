@@ -0,0 +1,103 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	DEFAULT_RETRY_MAX_ATTEMPTS = 5
+	DEFAULT_RETRY_BASE_DELAY   = time.Second
+	DEFAULT_RETRY_MAX_DELAY    = time.Minute
+)
+
+// RetryPolicy sends again the requests that fail with a transient error:
+// the 500, 502, 503 and 504 responses of twitter, its over capacity and
+// internal errors, the timeouts, the connections reset or refused and the
+// truncated responses.  The delay between two attempts doubles after every
+// attempt, up to MaxDelay, and is randomly shortened by up to half so that
+// many clients do not retry in lockstep.
+type RetryPolicy struct {
+	// the number of attempts of a request, the first included
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// replaced by tests
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func() float64
+}
+
+func NewRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) *RetryPolicy {
+	return &RetryPolicy{maxAttempts, baseDelay, maxDelay, sleepContext, rand.Float64}
+}
+
+func NewDefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(DEFAULT_RETRY_MAX_ATTEMPTS, DEFAULT_RETRY_BASE_DELAY, DEFAULT_RETRY_MAX_DELAY)
+}
+
+// Delay returns the delay to wait after the failure of the attempt-th
+// attempt, between half and all of BaseDelay * 2^(attempt-1) bounded by
+// MaxDelay.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d/2 + time.Duration(p.random()*float64(d/2))
+}
+
+// Retryable returns true when err is a transient failure worth retrying.  A
+// request that timed out is retryable, the end of the context of the caller
+// is checked by Do.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var twitterErr *TwitterErr
+	if errors.As(err, &twitterErr) {
+		if twitterErr.HasCode(ERR_OVER_CAPACITY, ERR_INTERNAL_ERROR) {
+			return true
+		}
+		switch twitterErr.Status {
+		case 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// the response was truncated
+		return true
+	} else if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// the other network errors, such as a bad url or certificate, are fatal
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Do calls f until it succeeds, fails with an error that is not Retryable,
+// MaxAttempts is reached or ctx is done, and returns the last error.  A nil
+// policy calls f once.
+func (p *RetryPolicy) Do(ctx context.Context, endpoint string, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !Retryable(err) {
+			return err
+		}
+		d := p.Delay(attempt)
+		log.Printf("attempt %v of %v on %v failed, retrying in %v: %v", attempt, p.MaxAttempts, endpointFamily(endpoint), d.Round(time.Millisecond), err)
+		if err := p.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package twitterintersection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// returns a policy that records its sleeps instead of sleeping
+func newTestRetryPolicy(maxAttempts int, sleeps *[]time.Duration) *RetryPolicy {
+	p := NewRetryPolicy(maxAttempts, time.Second, 10*time.Second)
+	p.random = func() float64 { return 1 }
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return ctx.Err()
+	}
+	return p
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := NewRetryPolicy(5, time.Second, 10*time.Second)
+	p.random = func() float64 { return 1 }
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range expected {
+		if delay := p.Delay(i + 1); delay != d {
+			t.Error("bad delay of attempt", i+1, delay)
+		}
+	}
+	p.random = func() float64 { return 0 }
+	if delay := p.Delay(3); delay != 2*time.Second {
+		t.Error("the jitter should shorten the delay by half at most", delay)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	retryable := []error{
+		NewTwitterErr("", 500),
+		NewTwitterErr("", 503),
+		&AccountErr{"bob", Followers, NewTwitterErr("", 504)},
+		NewTwitterErr(`{"errors":[{"code":130,"message":"Over capacity"}]}`, 403),
+		NewTwitterErr(`{"errors":[{"code":131,"message":"Internal error"}]}`, 200),
+		io.ErrUnexpectedEOF,
+		&url.Error{Op: "Get", URL: "/", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}},
+		&url.Error{Op: "Get", URL: "/", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}},
+		&url.Error{Op: "Get", URL: "/", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+	}
+	for _, err := range retryable {
+		if !Retryable(err) {
+			t.Error("should be retried", err)
+		}
+	}
+	fatal := []error{
+		NewTwitterErr("", 401),
+		NewTwitterErr("", 404),
+		errors.New("boom"),
+		context.Canceled,
+		&url.Error{Op: "Get", URL: "/", Err: context.Canceled},
+		&url.Error{Op: "Get", URL: "ftp2://x/", Err: errors.New("unsupported protocol scheme \"ftp2\"")},
+	}
+	for _, err := range fatal {
+		if Retryable(err) {
+			t.Error("should not be retried", err)
+		}
+	}
+}
+
+func TestGetAndDeserializeRetries(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(503)
+		case 2:
+			// truncated body
+			fmt.Fprint(w, `{"foo": "ba`)
+		default:
+			fmt.Fprint(w, `{"foo": "bar"}`)
+		}
+	}))
+	defer ts.Close()
+	var sleeps []time.Duration
+	tw := NewTwitterApi(ts.URL, "access_token", WithRetryPolicy(newTestRetryPolicy(5, &sleeps)))
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/foo", map[string]string{}, &m); err != nil {
+		t.Error(err)
+	} else if m["foo"] != "bar" {
+		t.Error("bad response", m)
+	}
+	if calls != 3 || len(sleeps) != 2 || sleeps[0] != time.Second || sleeps[1] != 2*time.Second {
+		t.Error("should have retried twice", calls, sleeps)
+	}
+}
+
+func TestGetAndDeserializeGivesUp(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(404)
+		} else {
+			w.WriteHeader(502)
+		}
+	}))
+	defer ts.Close()
+	var sleeps []time.Duration
+	tw := NewTwitterApi(ts.URL, "access_token", WithRetryPolicy(newTestRetryPolicy(3, &sleeps)))
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/foo", map[string]string{}, &m); err == nil || err.(*TwitterErr).Status != 502 {
+		t.Error("expected the last error", err)
+	}
+	if calls != 3 {
+		t.Error("should have stopped after 3 attempts", calls)
+	}
+	calls = 0
+	if err := tw.GetAndDeserialize(context.Background(), "/missing", map[string]string{}, &m); err == nil || calls != 1 {
+		t.Error("a fatal error should not be retried", calls, err)
+	}
+}
+
+func TestRetryOnTimeout(t *testing.T) {
+	// the handler of the request timed out may still run with the next one
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"foo": "bar"}`)
+	}))
+	defer ts.Close()
+	var sleeps []time.Duration
+	tw := NewTwitterApi(ts.URL, "access_token", WithTimeout(50*time.Millisecond), WithRetryPolicy(newTestRetryPolicy(3, &sleeps)))
+
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/foo", map[string]string{}, &m); err != nil || m["foo"] != "bar" {
+		t.Error("the request should be sent again after its timeout", err, m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls.Store(0)
+	if err := tw.GetAndDeserialize(ctx, "/foo", map[string]string{}, &m); err == nil || calls.Load() != 0 || len(sleeps) != 1 {
+		t.Error("a cancelled request should not be retried", err, calls.Load(), sleeps)
+	}
+}
+
+func TestGetAndDeserializeDoesNotRetryBadUrls(t *testing.T) {
+	var sleeps []time.Duration
+	tw := NewTwitterApi("ftp2://x", "access_token")
+	tw.Retry = newTestRetryPolicy(5, &sleeps)
+	m := make(map[string]string)
+	if err := tw.GetAndDeserialize(context.Background(), "/followers/ids.json", map[string]string{}, &m); err == nil {
+		t.Error("expected an error")
+	}
+	if len(sleeps) != 0 {
+		t.Error("a bad url should not be retried", sleeps)
+	}
+}
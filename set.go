@@ -0,0 +1,232 @@
+package twitterintersection
+
+import (
+	"container/heap"
+	"slices"
+	"sort"
+)
+
+// IdSet is a set of user ids kept as a sorted slice without repetitions, 8
+// bytes per id.  The operations on IdSets never modify their operands.
+type IdSet []uint64
+
+// NewIdSet returns the set of ids.  ids is sorted in place and reused by
+// the set, it must not be used afterward.
+func NewIdSet(ids []uint64) IdSet {
+	slices.Sort(ids)
+	n := 0
+	for i, id := range ids {
+		if i == 0 || id != ids[n-1] {
+			ids[n] = id
+			n++
+		}
+	}
+	return IdSet(ids[:n])
+}
+
+// Contains returns true if id is in the set.
+func (s IdSet) Contains(id uint64) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i] >= id })
+	return i < len(s) && s[i] == id
+}
+
+// Intersect returns the ids both in s and in other.
+func (s IdSet) Intersect(other IdSet) IdSet {
+	small, large := s, other
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	out := make(IdSet, 0, len(small))
+	if len(small)*16 < len(large) {
+		// look the few ids of small up in large instead of going through
+		// all of large
+		for _, id := range small {
+			i := sort.Search(len(large), func(i int) bool { return large[i] >= id })
+			if i == len(large) {
+				break
+			} else if large[i] == id {
+				out = append(out, id)
+			}
+			large = large[i:]
+		}
+		return out
+	}
+	for i, j := 0, 0; i < len(small) && j < len(large); {
+		switch {
+		case small[i] < large[j]:
+			i++
+		case small[i] > large[j]:
+			j++
+		default:
+			out = append(out, small[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Union returns the ids in s or in other.
+func (s IdSet) Union(other IdSet) IdSet {
+	out := make(IdSet, 0, len(s)+len(other))
+	i, j := 0, 0
+	for i < len(s) || j < len(other) {
+		switch {
+		case j == len(other) || (i < len(s) && s[i] < other[j]):
+			out = append(out, s[i])
+			i++
+		case i == len(s) || s[i] > other[j]:
+			out = append(out, other[j])
+			j++
+		default:
+			out = append(out, s[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Difference returns the ids of s that are not in other.
+func (s IdSet) Difference(other IdSet) IdSet {
+	out := make(IdSet, 0, len(s))
+	j := 0
+	for _, id := range s {
+		for j < len(other) && other[j] < id {
+			j++
+		}
+		if j == len(other) || other[j] != id {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// SymmetricDifference returns the ids either in s or in other but not in
+// both.
+func (s IdSet) SymmetricDifference(other IdSet) IdSet {
+	out := make(IdSet, 0)
+	i, j := 0, 0
+	for i < len(s) || j < len(other) {
+		switch {
+		case j == len(other) || (i < len(s) && s[i] < other[j]):
+			out = append(out, s[i])
+			i++
+		case i == len(s) || s[i] > other[j]:
+			out = append(out, other[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// IntersectIdSets returns the ids in every set.
+func IntersectIdSets(sets ...IdSet) IdSet {
+	if len(sets) == 0 {
+		return IdSet{}
+	}
+	// starting with the smallest sets keeps the intermediate results small
+	sorted := append([]IdSet(nil), sets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) < len(sorted[j]) })
+	out := sorted[0]
+	for _, set := range sorted[1:] {
+		out = out.Intersect(set)
+	}
+	if len(sorted) == 1 {
+		out = append(IdSet{}, out...)
+	}
+	return out
+}
+
+// UnionIdSets returns the ids in at least one of the sets.
+func UnionIdSets(sets ...IdSet) IdSet {
+	if len(sets) == 2 {
+		return sets[0].Union(sets[1])
+	}
+	return AtLeastIdSets(1, sets...)
+}
+
+// the number of ids of a block of an idSetBuilder
+const idSetBlockSize = 1 << 16
+
+// idSetBuilder collects ids in fixed size blocks, so the memory is not
+// doubled every time it grows as with append, then builds the IdSet in a
+// slice of the exact size.
+type idSetBuilder struct {
+	blocks [][]uint64
+	n      int
+}
+
+func (b *idSetBuilder) Add(id uint64) {
+	if len(b.blocks) == 0 || len(b.blocks[len(b.blocks)-1]) == idSetBlockSize {
+		b.blocks = append(b.blocks, make([]uint64, 0, idSetBlockSize))
+	}
+	last := len(b.blocks) - 1
+	b.blocks[last] = append(b.blocks[last], id)
+	b.n++
+}
+
+// Build returns the set of the ids added.  The builder is empty afterward.
+func (b *idSetBuilder) Build() IdSet {
+	ids := make([]uint64, 0, b.n)
+	for i, block := range b.blocks {
+		ids = append(ids, block...)
+		// the garbage collector can take the block back already
+		b.blocks[i] = nil
+	}
+	b.blocks, b.n = nil, 0
+	return NewIdSet(ids)
+}
+
+// the position of a k-way merge in one of its sets
+type idSetCursor struct {
+	set IdSet
+	pos int
+}
+
+// the cursors of a k-way merge, the one on the smallest id first
+type cursorHeap []*idSetCursor
+
+func (h cursorHeap) Len() int            { return len(h) }
+func (h cursorHeap) Less(i, j int) bool  { return h[i].set[h[i].pos] < h[j].set[h[j].pos] }
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*idSetCursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// AtLeastIdSets returns the ids in at least k of the sets, merging them all
+// at once.
+func AtLeastIdSets(k int, sets ...IdSet) IdSet {
+	h := make(cursorHeap, 0, len(sets))
+	for _, set := range sets {
+		if len(set) > 0 {
+			h = append(h, &idSetCursor{set, 0})
+		}
+	}
+	heap.Init(&h)
+	out := make(IdSet, 0)
+	for len(h) > 0 {
+		id := h[0].set[h[0].pos]
+		count := 0
+		for len(h) > 0 && h[0].set[h[0].pos] == id {
+			count++
+			if c := h[0]; c.pos+1 < len(c.set) {
+				c.pos++
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+		if count >= k {
+			out = append(out, id)
+		}
+	}
+	return out
+}
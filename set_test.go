@@ -0,0 +1,163 @@
+package twitterintersection
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestNewIdSet(t *testing.T) {
+	if s := NewIdSet([]uint64{1, 3, 2, 1, 4, 3, 3, 2, 1}); !reflect.DeepEqual(s, IdSet{1, 2, 3, 4}) {
+		t.Error(s)
+	}
+	if s := NewIdSet([]uint64{}); len(s) != 0 {
+		t.Error(s)
+	}
+	s := NewIdSet([]uint64{5, 1, 3})
+	if !s.Contains(3) || s.Contains(2) || s.Contains(6) || s.Contains(0) {
+		t.Error("bad Contains")
+	}
+}
+
+func TestIdSetBuilder(t *testing.T) {
+	var builder idSetBuilder
+	for i := 3*idSetBlockSize - 1; i >= 0; i-- {
+		builder.Add(uint64(i / 2))
+	}
+	s := builder.Build()
+	if len(s) != 3*idSetBlockSize/2 || s[0] != 0 || s[len(s)-1] != 3*idSetBlockSize/2-1 {
+		t.Error("bad set", len(s))
+	}
+	if s := builder.Build(); len(s) != 0 {
+		t.Error("the builder should be empty", s)
+	}
+}
+
+func TestIdSetOperations(t *testing.T) {
+	a, b := IdSet{1, 2, 3, 4, 10}, IdSet{2, 4, 5, 11}
+	if s := a.Intersect(b); !reflect.DeepEqual(s, IdSet{2, 4}) {
+		t.Error("bad intersection", s)
+	}
+	if s := a.Union(b); !reflect.DeepEqual(s, IdSet{1, 2, 3, 4, 5, 10, 11}) {
+		t.Error("bad union", s)
+	}
+	if s := a.Difference(b); !reflect.DeepEqual(s, IdSet{1, 3, 10}) {
+		t.Error("bad difference", s)
+	}
+	if s := a.SymmetricDifference(b); !reflect.DeepEqual(s, IdSet{1, 3, 5, 10, 11}) {
+		t.Error("bad symmetric difference", s)
+	}
+	if !reflect.DeepEqual(a, IdSet{1, 2, 3, 4, 10}) || !reflect.DeepEqual(b, IdSet{2, 4, 5, 11}) {
+		t.Error("the operands should not be modified")
+	}
+}
+
+func TestIntersectUnbalancedIdSets(t *testing.T) {
+	large := NewIdSet(uint64Range(10000))
+	small := IdSet{3, 5000, 9999, 10000, 20000}
+	if s := small.Intersect(large); !reflect.DeepEqual(s, IdSet{3, 5000, 9999}) {
+		t.Error(s)
+	}
+	if s := large.Intersect(small); !reflect.DeepEqual(s, IdSet{3, 5000, 9999}) {
+		t.Error(s)
+	}
+}
+
+func TestIdSetsOfManySets(t *testing.T) {
+	sets := []IdSet{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {6}}
+	if s := IntersectIdSets(sets[:3]...); !reflect.DeepEqual(s, IdSet{3}) {
+		t.Error("bad intersection", s)
+	}
+	if s := IntersectIdSets(sets...); len(s) != 0 {
+		t.Error("bad intersection", s)
+	}
+	if s := IntersectIdSets(); len(s) != 0 {
+		t.Error("bad empty intersection", s)
+	}
+	if s := UnionIdSets(sets...); !reflect.DeepEqual(s, IdSet{1, 2, 3, 4, 5, 6}) {
+		t.Error("bad union", s)
+	}
+	if s := AtLeastIdSets(2, sets...); !reflect.DeepEqual(s, IdSet{2, 3, 4}) {
+		t.Error("bad atleast", s)
+	}
+}
+
+// returns n random ids among the first 4n integers
+func randomIdSet(r *rand.Rand, n int) IdSet {
+	ids := make([]uint64, n)
+	for i := range ids {
+		ids[i] = uint64(r.Int63n(int64(4 * n)))
+	}
+	return NewIdSet(ids)
+}
+
+func benchmarkIdSets(b *testing.B, n int, f func(a, c IdSet) IdSet) {
+	r := rand.New(rand.NewSource(1))
+	a, c := randomIdSet(r, n), randomIdSet(r, n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f(a, c)
+	}
+}
+
+func BenchmarkIntersect1M(b *testing.B) {
+	benchmarkIdSets(b, 1000000, IdSet.Intersect)
+}
+
+func BenchmarkUnion1M(b *testing.B) {
+	benchmarkIdSets(b, 1000000, IdSet.Union)
+}
+
+func BenchmarkDifference1M(b *testing.B) {
+	benchmarkIdSets(b, 1000000, IdSet.Difference)
+}
+
+func BenchmarkNewIdSet1M(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	ids := make([]uint64, 1000000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := range ids {
+			ids[j] = uint64(r.Int63())
+		}
+		b.StartTimer()
+		NewIdSet(ids)
+	}
+}
+
+// intersects two channels of 50M ids each and reports the peak of the heap,
+// about 8 bytes per id read
+func BenchmarkIntersection50M(b *testing.B) {
+	if testing.Short() {
+		b.Skip("50M ids take a few seconds")
+	}
+	const n = 50000000
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		c := Intersection(ctx, countingChannel(n, 1), countingChannel(n, 2))
+		count := 0
+		for range c {
+			count++
+		}
+		if count != n/2 {
+			b.Fatal("bad intersection", count)
+		}
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	b.ReportMetric(float64(m.HeapSys)/(1<<20), "MB-heap")
+}
+
+// sends the n ids 0, step, 2 step, ... in a channel closed afterward
+func countingChannel(n int, step uint64) <-chan uint64 {
+	c := make(chan uint64, 1024)
+	go func() {
+		for i := 0; i < n; i++ {
+			c <- uint64(i) * step
+		}
+		close(c)
+	}()
+	return c
+}
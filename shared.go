@@ -0,0 +1,85 @@
+package twitterintersection
+
+import (
+	"context"
+	"sync"
+)
+
+// SharingGetter is a FollowerGetter that fetches only once the pages of ids
+// requested by the many crawls of an account named more than once in the
+// queries, such as alice in "(alice & bob) | (alice & carol)".  A page is
+// kept until every crawl of its account received it.
+type SharingGetter struct {
+	FollowerGetter
+	mu sync.Mutex
+	// the number of crawls of every account named more than once
+	crawls map[string]int
+	pages  map[string]*sharedPage
+}
+
+// a page of ids requested by many crawls
+type sharedPage struct {
+	done chan struct{}
+	page *FollowerIDList
+	// the number of crawls that did not request the page yet
+	left int
+}
+
+// NewSharingGetter returns a SharingGetter for the crawls of accounts, whose
+// screen names must already be resolved.
+func NewSharingGetter(followerGetter FollowerGetter, accounts []*AccountExpr) *SharingGetter {
+	counts := make(map[string]int)
+	for _, account := range accounts {
+		counts[sharedKey(account.Relation, account.Account())]++
+	}
+	crawls := make(map[string]int)
+	for key, count := range counts {
+		if count > 1 {
+			crawls[key] = count
+		}
+	}
+	return &SharingGetter{FollowerGetter: followerGetter, crawls: crawls, pages: make(map[string]*sharedPage)}
+}
+
+func sharedKey(relation Relation, account string) string {
+	return string(relation) + ":" + account
+}
+
+// ResolveScreenNames resolves the screen names with the FollowerGetter, or
+// resolves none when it is not a ScreenNameResolver.
+func (g *SharingGetter) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	if resolver, ok := g.FollowerGetter.(ScreenNameResolver); ok {
+		return resolver.ResolveScreenNames(ctx, screenNames)
+	}
+	return make(map[string]uint64), nil
+}
+
+func (g *SharingGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	key := sharedKey(relation, screenName)
+	g.mu.Lock()
+	crawls, ok := g.crawls[key]
+	if !ok {
+		g.mu.Unlock()
+		return g.FollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)
+	}
+	key += "@" + cursor
+	shared, ok := g.pages[key]
+	if !ok {
+		shared = &sharedPage{done: make(chan struct{}), left: crawls}
+		g.pages[key] = shared
+		go func() {
+			shared.page = <-g.FollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)
+			close(shared.done)
+		}()
+	}
+	if shared.left--; shared.left == 0 {
+		delete(g.pages, key)
+	}
+	g.mu.Unlock()
+	followerListC := make(chan *FollowerIDList, 1)
+	go func() {
+		<-shared.done
+		followerListC <- shared.page
+	}()
+	return followerListC
+}
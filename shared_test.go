@@ -0,0 +1,65 @@
+package twitterintersection
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// countingGetter returns the followers of mapFollowerGetter in two pages
+// and counts the requests of every page.
+type countingGetter struct {
+	mapFollowerGetter
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (g *countingGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	g.mu.Lock()
+	g.requests[string(relation)+":"+screenName+"@"+cursor]++
+	g.mu.Unlock()
+	followers := (<-g.mapFollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)).Followers
+	page := &FollowerIDList{NextCursor: "1", Followers: followers[:len(followers)/2]}
+	if cursor == "1" {
+		page = &FollowerIDList{NextCursor: "0", Followers: followers[len(followers)/2:]}
+	}
+	followerListC := make(chan *FollowerIDList, 1)
+	followerListC <- page
+	return followerListC
+}
+
+func TestSharingGetterFetchesOnce(t *testing.T) {
+	fg := &countingGetter{mapFollowerGetter: mapFollowerGetter{
+		"a":         {1, 2, 3, 4},
+		"friends:a": {4, 5},
+		"b":         {3, 4, 5},
+		"c":         {4, 6},
+	}, requests: make(map[string]int)}
+	expr, err := ParseQuery("(a & b) | (a & c) | (friends:a - a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewSharingGetter(fg, QueryAccounts(expr))
+
+	for _, engine := range []SetEngine{MemoryEngine{}, NewDiskEngine(t.TempDir(), 2)} {
+		for key := range fg.requests {
+			delete(fg.requests, key)
+		}
+		if ids := evalQuery(t, expr.String(), g, engine); !reflect.DeepEqual(ids, []uint64{3, 4, 5}) {
+			t.Error("bad ids", ids)
+		}
+		expt := map[string]int{
+			"followers:a@-1": 1, "followers:a@1": 1,
+			"friends:a@-1": 1, "friends:a@1": 1,
+			"followers:b@-1": 1, "followers:b@1": 1,
+			"followers:c@-1": 1, "followers:c@1": 1,
+		}
+		if !reflect.DeepEqual(fg.requests, expt) {
+			t.Error("every page should be fetched once", fg.requests)
+		}
+		if len(g.pages) != 0 {
+			t.Error("the pages should be forgotten once shared", len(g.pages))
+		}
+	}
+}
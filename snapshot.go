@@ -0,0 +1,304 @@
+package twitterintersection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnapshotTimeLayout is the layout of the names of the snapshot files,
+// without extension.
+const SnapshotTimeLayout = "20060102T150405Z"
+
+// Snapshot is the complete set of the ids of the users in relation with an
+// account at the time it was fetched.
+type Snapshot struct {
+	ScreenName string    `json:"screen_name"`
+	Relation   Relation  `json:"relation"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	Ids        []uint64  `json:"ids"`
+}
+
+// SnapshotStore keeps every snapshot of the accounts in a directory, one
+// file per snapshot named after its fetch time.
+type SnapshotStore struct {
+	Dir string
+}
+
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{dir}
+}
+
+func (s *SnapshotStore) dir(relation Relation, screenName string) string {
+	return filepath.Join(s.Dir, string(relation), accountDir(screenName))
+}
+
+func (s *SnapshotStore) path(relation Relation, screenName string, fetchedAt time.Time) string {
+	return filepath.Join(s.dir(relation, screenName), fetchedAt.UTC().Format(SnapshotTimeLayout)+".json")
+}
+
+// Save stores a snapshot.
+func (s *SnapshotStore) Save(snapshot *Snapshot) error {
+	if err := os.MkdirAll(s.dir(snapshot.Relation, snapshot.ScreenName), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomically(s.path(snapshot.Relation, snapshot.ScreenName, snapshot.FetchedAt), snapshot)
+}
+
+// List returns the fetch times of the snapshots of the users in relation
+// with screenName, from the oldest to the newest.
+func (s *SnapshotStore) List(relation Relation, screenName string) ([]time.Time, error) {
+	files, err := ioutil.ReadDir(s.dir(relation, screenName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, 0, len(files))
+	for _, f := range files {
+		if t, err := time.Parse(SnapshotTimeLayout, strings.TrimSuffix(f.Name(), ".json")); err == nil && strings.HasSuffix(f.Name(), ".json") {
+			times = append(times, t)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+// Load returns the snapshot of the users in relation with screenName fetched
+// at fetchedAt.
+func (s *SnapshotStore) Load(relation Relation, screenName string, fetchedAt time.Time) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(s.path(relation, screenName, fetchedAt))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := new(Snapshot)
+	return snapshot, json.Unmarshal(data, snapshot)
+}
+
+// Remove removes the snapshot of the users in relation with screenName
+// fetched at fetchedAt.
+func (s *SnapshotStore) Remove(relation Relation, screenName string, fetchedAt time.Time) error {
+	return os.Remove(s.path(relation, screenName, fetchedAt))
+}
+
+// Accounts returns the accounts having snapshots, sorted by relation then
+// directory name.  The screen names are in lower case and the accounts
+// fetched by id have the screen name recorded for their id, if any.
+func (s *SnapshotStore) Accounts() ([]*AccountExpr, error) {
+	ids, err := s.ScreenNames()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint64]string, len(ids))
+	for name, id := range ids {
+		if other, ok := names[id]; !ok || name < other {
+			names[id] = name
+		}
+	}
+	accounts := make([]*AccountExpr, 0)
+	for _, relation := range []Relation{Followers, Friends} {
+		dirs, err := ioutil.ReadDir(filepath.Join(s.Dir, string(relation)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				account := dirAccount(relation, dir.Name())
+				if account.Id != 0 {
+					account.ScreenName = names[account.Id]
+				}
+				accounts = append(accounts, account)
+			}
+		}
+	}
+	return accounts, nil
+}
+
+func (s *SnapshotStore) screenNamesPath() string {
+	return filepath.Join(s.Dir, "screen_names.json")
+}
+
+// ScreenNames returns the ids recorded by SaveScreenNames, keyed by screen
+// name in lower case.
+func (s *SnapshotStore) ScreenNames() (map[string]uint64, error) {
+	ids := make(map[string]uint64)
+	data, err := ioutil.ReadFile(s.screenNamesPath())
+	if os.IsNotExist(err) {
+		return ids, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ids, json.Unmarshal(data, &ids)
+}
+
+// SaveScreenNames records the ids of screen names, so the accounts can be
+// resolved offline.  The screen names already recorded are kept unless they
+// are given a new id.
+func (s *SnapshotStore) SaveScreenNames(ids map[string]uint64) error {
+	recorded, err := s.ScreenNames()
+	if err != nil {
+		return err
+	}
+	for name, id := range ids {
+		recorded[strings.ToLower(name)] = id
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomically(s.screenNamesPath(), recorded)
+}
+
+// ResolveScreenNames returns the ids recorded for the screen names.
+func (s *SnapshotStore) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	recorded, err := s.ScreenNames()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uint64)
+	for _, name := range screenNames {
+		if id, ok := recorded[strings.ToLower(name)]; ok {
+			ids[strings.ToLower(name)] = id
+		}
+	}
+	return ids, nil
+}
+
+// Latest returns the newest snapshot of the users in relation with
+// screenName or nil if there is none.
+func (s *SnapshotStore) Latest(relation Relation, screenName string) (*Snapshot, error) {
+	times, err := s.List(relation, screenName)
+	if err != nil || len(times) == 0 {
+		return nil, err
+	}
+	return s.Load(relation, screenName, times[len(times)-1])
+}
+
+// CachingGetter is a FollowerGetter that answers with the latest snapshot
+// of an account when it is younger than TTL and saves a new snapshot every
+// time the ids of an account are completely fetched.  In Offline mode, the
+// latest snapshot is always used and nothing is fetched.
+type CachingGetter struct {
+	FollowerGetter
+	Store   *SnapshotStore
+	TTL     time.Duration
+	Offline bool
+
+	mu      sync.Mutex
+	pending map[string]*Snapshot
+
+	// replaced by tests
+	now func() time.Time
+}
+
+func NewCachingGetter(followerGetter FollowerGetter, store *SnapshotStore, ttl time.Duration, offline bool) *CachingGetter {
+	return &CachingGetter{
+		FollowerGetter: followerGetter,
+		Store:          store,
+		TTL:            ttl,
+		Offline:        offline,
+		pending:        make(map[string]*Snapshot),
+		now:            time.Now,
+	}
+}
+
+// returns the snapshot to use instead of fetching the account, if any
+func (g *CachingGetter) cached(relation Relation, screenName string) (*Snapshot, error) {
+	snapshot, err := g.Store.Latest(relation, screenName)
+	if err != nil || snapshot == nil {
+		return nil, err
+	} else if g.Offline || g.now().Sub(snapshot.FetchedAt) < g.TTL {
+		return snapshot, nil
+	}
+	return nil, nil
+}
+
+// Check returns an error if, in offline mode, there is no snapshot of the
+// users in relation with screenName.
+func (g *CachingGetter) Check(relation Relation, screenName string) error {
+	if !g.Offline {
+		return nil
+	}
+	if snapshot, err := g.cached(relation, screenName); err != nil {
+		return err
+	} else if snapshot == nil {
+		return errors.New("no snapshot of the " + string(relation) + " of " + screenName + " available offline")
+	}
+	return nil
+}
+
+// ResolveScreenNames resolves the screen names with the FollowerGetter, when
+// it is a ScreenNameResolver and not Offline, and records the ids in the
+// store.  Otherwise the ids recorded in the store are returned.
+func (g *CachingGetter) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	resolver, ok := g.FollowerGetter.(ScreenNameResolver)
+	if !ok || g.Offline {
+		return g.Store.ResolveScreenNames(ctx, screenNames)
+	}
+	ids, err := resolver.ResolveScreenNames(ctx, screenNames)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Store.SaveScreenNames(ids); err != nil {
+		log.Println("cannot record the screen names:", err)
+	}
+	return ids, nil
+}
+
+func (g *CachingGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	followerListC := make(chan *FollowerIDList)
+	key := string(relation) + ":" + strings.ToLower(screenName)
+	go func() {
+		if cursor == "-1" {
+			if snapshot, err := g.cached(relation, screenName); err != nil {
+				log.Println("cannot read the snapshot of", screenName, ":", err)
+			} else if snapshot != nil {
+				followerListC <- &FollowerIDList{NextCursor: "0", Followers: snapshot.Ids}
+				return
+			}
+			if g.Offline {
+				followerListC <- &FollowerIDList{Err: errors.New("no snapshot available offline")}
+				return
+			}
+			g.mu.Lock()
+			g.pending[key] = &Snapshot{screenName, relation, g.now(), make([]uint64, 0)}
+			g.mu.Unlock()
+		}
+		page := <-g.FollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)
+		if page.Err == nil {
+			g.record(key, page)
+		}
+		followerListC <- page
+	}()
+	return followerListC
+}
+
+// adds a page to the snapshot being fetched and saves it after its last
+// page
+func (g *CachingGetter) record(key string, page *FollowerIDList) {
+	g.mu.Lock()
+	snapshot, ok := g.pending[key]
+	if ok {
+		snapshot.Ids = append(snapshot.Ids, page.Followers...)
+		if page.NextCursor == "0" || page.NextCursor == "" {
+			delete(g.pending, key)
+		} else {
+			snapshot = nil
+		}
+	}
+	g.mu.Unlock()
+	if snapshot != nil {
+		if err := g.Store.Save(snapshot); err != nil {
+			log.Println("cannot save the snapshot of", snapshot.ScreenName, ":", err)
+		}
+	}
+}
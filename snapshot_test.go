@@ -0,0 +1,139 @@
+package twitterintersection
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSnapshotStore(t *testing.T) *SnapshotStore {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSnapshotStore(dir)
+}
+
+func TestSnapshotStore(t *testing.T) {
+	s := newTestSnapshotStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	if snapshot, err := s.Latest(Followers, "bobLeChef"); err != nil || snapshot != nil {
+		t.Error("there should be no snapshot", snapshot, err)
+	}
+	t1, t2 := time.Date(2015, 3, 4, 10, 0, 0, 0, time.UTC), time.Date(2015, 3, 5, 10, 0, 0, 0, time.UTC)
+	s.Save(&Snapshot{"bobLeChef", Followers, t2, []uint64{1, 2, 3}})
+	s.Save(&Snapshot{"BOBLECHEF", Followers, t1, []uint64{1, 2}})
+	s.Save(&Snapshot{"bobLeChef", Friends, t1, []uint64{5}})
+
+	if times, err := s.List(Followers, "bobLeChef"); err != nil {
+		t.Error(err)
+	} else if len(times) != 2 || !times[0].Equal(t1) || !times[1].Equal(t2) {
+		t.Error("bad snapshot times", times)
+	}
+	if snapshot, err := s.Latest(Followers, "boblechef"); err != nil {
+		t.Error(err)
+	} else if !snapshot.FetchedAt.Equal(t2) || !reflect.DeepEqual(snapshot.Ids, []uint64{1, 2, 3}) {
+		t.Error("bad snapshot", snapshot)
+	}
+	if snapshot, err := s.Load(Friends, "bobLeChef", t1); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(snapshot.Ids, []uint64{5}) {
+		t.Error("bad snapshot", snapshot)
+	}
+	if accounts, err := s.Accounts(); err != nil || !reflect.DeepEqual(accounts, []*AccountExpr{{Relation: Followers, ScreenName: "boblechef"}, {Relation: Friends, ScreenName: "boblechef"}}) {
+		t.Error("bad accounts", accounts, err)
+	}
+	if err := s.Remove(Followers, "bobLeChef", t1); err != nil {
+		t.Error(err)
+	}
+	if times, _ := s.List(Followers, "bobLeChef"); len(times) != 1 || !times[0].Equal(t2) {
+		t.Error("the snapshot should be removed", times)
+	}
+}
+
+func TestCachingGetter(t *testing.T) {
+	s := newTestSnapshotStore(t)
+	defer os.RemoveAll(s.Dir)
+	now := time.Date(2015, 3, 4, 10, 0, 0, 0, time.UTC)
+	g := NewCachingGetter(&MockFollowerGetter{t}, s, time.Hour, false)
+	g.now = func() time.Time { return now }
+
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), g, "justinBieber")); !reflect.DeepEqual(ids, []uint64{1, 2, 3, 4}) {
+		t.Error("bad ids", ids)
+	}
+	if snapshot, _ := s.Latest(Followers, "justinBieber"); snapshot == nil || !reflect.DeepEqual(snapshot.Ids, []uint64{1, 2, 3, 4}) {
+		t.Error("the snapshot should be saved", snapshot)
+	}
+
+	s.Save(&Snapshot{"justinBieber", Followers, now.Add(-30 * time.Minute), []uint64{5, 6}})
+	s.Save(&Snapshot{"justinBieber", Followers, now.Add(-2 * time.Hour), []uint64{7}})
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), g, "justinBieber")); !reflect.DeepEqual(ids, []uint64{1, 2, 3, 4}) {
+		t.Error("the latest snapshot should be used", ids)
+	}
+
+	now = now.Add(2 * time.Hour)
+	g.FollowerGetter = &failingFollowerGetter{MockFollowerGetter{t}}
+	g.Offline = true
+	if err := g.Check(Followers, "justinBieber"); err != nil {
+		t.Error(err)
+	}
+	if ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), g, "justinBieber")); !reflect.DeepEqual(ids, []uint64{1, 2, 3, 4}) {
+		t.Error("an old snapshot should be used offline", ids)
+	}
+	if err := g.Check(Friends, "justinBieber"); err == nil {
+		t.Error("there is no snapshot of the friends")
+	}
+	if _, err := GetFriendIds(context.Background(), g, "justinBieber"); <-err == nil {
+		t.Error("the friends cannot be fetched offline")
+	}
+}
+
+func TestSnapshotStoreScreenNames(t *testing.T) {
+	s := newTestSnapshotStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	if ids, err := s.ScreenNames(); err != nil || len(ids) != 0 {
+		t.Error("there should be no screen name", ids, err)
+	}
+	s.SaveScreenNames(map[string]uint64{"BobLeChef": 1492, "alice": 12})
+	s.SaveScreenNames(map[string]uint64{"alice": 13})
+	if ids, err := s.ScreenNames(); err != nil || !reflect.DeepEqual(ids, map[string]uint64{"boblechef": 1492, "alice": 13}) {
+		t.Error("bad screen names", ids, err)
+	}
+	s.Save(&Snapshot{IdAccount(1492), Followers, time.Now(), []uint64{1}})
+	s.Save(&Snapshot{IdAccount(7), Followers, time.Now(), []uint64{2}})
+	if snapshot, err := s.Latest(Followers, "id:1492"); err != nil || !reflect.DeepEqual(snapshot.Ids, []uint64{1}) {
+		t.Error("bad snapshot", snapshot, err)
+	}
+	expected := []*AccountExpr{{Relation: Followers, ScreenName: "boblechef", Id: 1492}, {Relation: Followers, Id: 7}}
+	if accounts, err := s.Accounts(); err != nil || !reflect.DeepEqual(accounts, expected) {
+		t.Error("bad accounts", accounts, err)
+	}
+}
+
+func TestCachingGetterResolveScreenNames(t *testing.T) {
+	s := newTestSnapshotStore(t)
+	defer os.RemoveAll(s.Dir)
+	resolver := &recordingResolver{ids: map[string]uint64{"boblechef": 1492}}
+	g := NewCachingGetter(struct {
+		FollowerGetter
+		ScreenNameResolver
+	}{&MockFollowerGetter{t}, resolver}, s, time.Hour, false)
+
+	if ids, err := g.ResolveScreenNames(context.Background(), []string{"BobLeChef", "alice"}); err != nil || !reflect.DeepEqual(ids, map[string]uint64{"boblechef": 1492}) {
+		t.Error("bad ids", ids, err)
+	}
+	// offline, the ids recorded are used
+	g.Offline = true
+	resolver.ids = nil
+	if ids, err := g.ResolveScreenNames(context.Background(), []string{"boblechef", "alice"}); err != nil || !reflect.DeepEqual(ids, map[string]uint64{"boblechef": 1492}) {
+		t.Error("bad ids offline", ids, err)
+	}
+	if len(resolver.calls) != 1 {
+		t.Error("nothing should be resolved offline", resolver.calls)
+	}
+}
@@ -0,0 +1,499 @@
+package twitterintersection
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// the default number of ids of a run of a DiskEngine, 32MB
+const DEFAULT_SPILL_RUN_SIZE = 1 << 22
+
+// the default number of run files a DiskEngine merges at once
+const DEFAULT_MERGE_FAN_IN = 64
+
+// the size of the buffers of the run files
+const runBufferSize = 64 << 10
+
+// SetEngine computes the set operations of the queries.  The ids returned
+// are in increasing order and without repetitions, the error channel
+// receives the error that stopped an operation, if any.
+type SetEngine interface {
+	AtLeast(ctx context.Context, k int, cs ...<-chan uint64) (<-chan uint64, <-chan error)
+	Difference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error)
+	SymmetricDifference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error)
+}
+
+// MemoryEngine computes the set operations with IdSets, in memory.
+type MemoryEngine struct{}
+
+// returns an error channel already closed
+func noErrors() <-chan error {
+	errc := make(chan error)
+	close(errc)
+	return errc
+}
+
+func (MemoryEngine) AtLeast(ctx context.Context, k int, cs ...<-chan uint64) (<-chan uint64, <-chan error) {
+	switch k {
+	case len(cs):
+		return Intersection(ctx, cs...), noErrors()
+	case 1:
+		return Union(ctx, cs...), noErrors()
+	}
+	return AtLeast(ctx, k, cs...), noErrors()
+}
+
+func (MemoryEngine) Difference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error) {
+	return Difference(ctx, a, b), noErrors()
+}
+
+func (MemoryEngine) SymmetricDifference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error) {
+	return SymmetricDifference(ctx, a, b), noErrors()
+}
+
+// DiskEngine computes the set operations with a fixed memory ceiling.  The
+// ids of every input are sorted by runs of RunSize ids written in files of
+// Dir.  While there are more than FanIn runs, the runs of an input are
+// merged, FanIn at a time, into a new run, then all the runs are merged at
+// once.  An input takes at most 8 * RunSize bytes while it is read and a
+// merge 64KB per run, so an operation has at most FanIn operands.
+type DiskEngine struct {
+	Dir     string
+	RunSize int
+	FanIn   int
+}
+
+func NewDiskEngine(dir string, runSize int) *DiskEngine {
+	return &DiskEngine{dir, runSize, DEFAULT_MERGE_FAN_IN}
+}
+
+func (e *DiskEngine) AtLeast(ctx context.Context, k int, cs ...<-chan uint64) (<-chan uint64, <-chan error) {
+	return e.merge(ctx, cs, func(from []bool) bool {
+		count := 0
+		for _, in := range from {
+			if in {
+				count++
+			}
+		}
+		return count >= k
+	})
+}
+
+func (e *DiskEngine) Difference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error) {
+	return e.merge(ctx, []<-chan uint64{a, b}, func(from []bool) bool {
+		return from[0] && !from[1]
+	})
+}
+
+func (e *DiskEngine) SymmetricDifference(ctx context.Context, a, b <-chan uint64) (<-chan uint64, <-chan error) {
+	return e.merge(ctx, []<-chan uint64{a, b}, func(from []bool) bool {
+		return from[0] != from[1]
+	})
+}
+
+// spills all the inputs then sends the ids for which keep, given the inputs
+// holding the id, returns true
+func (e *DiskEngine) merge(ctx context.Context, cs []<-chan uint64, keep func(from []bool) bool) (<-chan uint64, <-chan error) {
+	out := make(chan uint64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		if err := e.mergeRuns(ctx, cs, out, keep); err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+func (e *DiskEngine) mergeRuns(ctx context.Context, cs []<-chan uint64, out chan<- uint64, keep func(from []bool) bool) error {
+	if e.FanIn < 2 {
+		drainAll(ctx, cs)
+		return errors.New("cannot merge less than 2 runs at once, the fan-in is " + strconv.Itoa(e.FanIn))
+	} else if len(cs) > e.FanIn {
+		drainAll(ctx, cs)
+		return errors.New("cannot merge more than " + strconv.Itoa(e.FanIn) + " operands at once, there are " + strconv.Itoa(len(cs)))
+	}
+	if err := os.MkdirAll(e.Dir, 0755); err != nil {
+		drainAll(ctx, cs)
+		return err
+	}
+	dir, err := os.MkdirTemp(e.Dir, "spill-")
+	if err != nil {
+		drainAll(ctx, cs)
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	runs := make([][]string, len(cs))
+	errs := make([]error, len(cs))
+	var wg sync.WaitGroup
+	wg.Add(len(cs))
+	for i, c := range cs {
+		go func(i int, c <-chan uint64) {
+			runs[i], errs[i] = e.spill(ctx, filepath.Join(dir, strconv.Itoa(i)), c)
+			wg.Done()
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := e.reduceRuns(ctx, dir, runs); err != nil {
+		return err
+	}
+
+	inputs := make([]idIterator, len(cs))
+	for i := range runs {
+		readers := make([]idIterator, len(runs[i]))
+		for j, path := range runs[i] {
+			r, err := openRun(path)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			readers[j] = r
+		}
+		m, err := newMerger(readers)
+		if err != nil {
+			return err
+		}
+		inputs[i] = &distinctIterator{m}
+	}
+	m, err := newMerger(inputs)
+	if err != nil {
+		return err
+	}
+	for {
+		id, from, ok, err := m.next()
+		if err != nil || !ok {
+			return err
+		}
+		if keep(from) && !send(ctx, out, id) {
+			return ctx.Err()
+		}
+	}
+}
+
+// merges the runs of the inputs, in dir, until there are at most FanIn
+// runs.  The input with the most runs has its first FanIn runs merged into
+// one at every pass.
+func (e *DiskEngine) reduceRuns(ctx context.Context, dir string, runs [][]string) error {
+	total := 0
+	for _, r := range runs {
+		total += len(r)
+	}
+	for pass := 0; total > e.FanIn; pass++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		i := 0
+		for j := range runs {
+			if len(runs[j]) > len(runs[i]) {
+				i = j
+			}
+		}
+		n := e.FanIn
+		if n > len(runs[i]) {
+			n = len(runs[i])
+		}
+		path := filepath.Join(dir, "merged-"+strconv.Itoa(pass))
+		if err := mergeRunFiles(path, runs[i][:n]); err != nil {
+			return err
+		}
+		runs[i] = append(runs[i][n:], path)
+		total -= n - 1
+	}
+	return nil
+}
+
+// merges the run files of paths into the run file path, without
+// repetitions, and removes them
+func mergeRunFiles(path string, paths []string) error {
+	readers := make([]idIterator, len(paths))
+	for i, p := range paths {
+		r, err := openRun(p)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		readers[i] = r
+	}
+	m, err := newMerger(readers)
+	if err != nil {
+		return err
+	}
+	if err := writeRun(path, &distinctIterator{m}); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		os.Remove(p)
+	}
+	return nil
+}
+
+// SpilledIds are ids written in a run file, read back in the order they
+// were written.
+type SpilledIds struct {
+	path string
+}
+
+// Spill writes the ids of c in a file of Dir, so that a result can wait on
+// disk instead of in memory.  c is read until it is closed.
+func (e *DiskEngine) Spill(ctx context.Context, c <-chan uint64) (*SpilledIds, error) {
+	if err := os.MkdirAll(e.Dir, 0755); err != nil {
+		drainAll(ctx, []<-chan uint64{c})
+		return nil, err
+	}
+	f, err := os.CreateTemp(e.Dir, "result-")
+	if err != nil {
+		drainAll(ctx, []<-chan uint64{c})
+		return nil, err
+	}
+	f.Close()
+	if err := writeRun(f.Name(), &channelIterator{ctx, c}); err != nil {
+		drainAll(ctx, []<-chan uint64{c})
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &SpilledIds{f.Name()}, nil
+}
+
+// Ids returns the spilled ids, read in the background.
+func (s *SpilledIds) Ids(ctx context.Context) (<-chan uint64, <-chan error) {
+	idsC := make(chan uint64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(idsC)
+		r, err := openRun(s.path)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer r.Close()
+		for id, ok, err := r.next(); ok || err != nil; id, ok, err = r.next() {
+			if err != nil {
+				errc <- err
+				return
+			} else if !send(ctx, idsC, id) {
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return idsC, errc
+}
+
+// Remove removes the file of the ids.
+func (s *SpilledIds) Remove() error {
+	return os.Remove(s.path)
+}
+
+// reads the channels of cs until they are closed or ctx is done, so that
+// their producers are not blocked
+func drainAll(ctx context.Context, cs []<-chan uint64) {
+	for _, c := range cs {
+		for _, ok := receive(ctx, c); ok; _, ok = receive(ctx, c) {
+		}
+	}
+}
+
+// writes the ids of c, by sorted runs of RunSize ids at most, in files
+// prefixed by prefix and returns their paths.  On error, c is still read
+// until it is closed.
+func (e *DiskEngine) spill(ctx context.Context, prefix string, c <-chan uint64) ([]string, error) {
+	runs := make([]string, 0)
+	buffer := make([]uint64, 0, e.RunSize)
+	var err error
+	flush := func() {
+		if err == nil && len(buffer) > 0 {
+			path := prefix + "-" + strconv.Itoa(len(runs))
+			err = writeRun(path, &sliceIterator{ids: NewIdSet(buffer)})
+			runs = append(runs, path)
+		}
+		buffer = buffer[:0]
+	}
+	for id, ok := receive(ctx, c); ok; id, ok = receive(ctx, c) {
+		if err != nil {
+			continue
+		}
+		buffer = append(buffer, id)
+		if len(buffer) >= e.RunSize {
+			flush()
+		}
+	}
+	flush()
+	return runs, err
+}
+
+// writes the ids of it in the run file path
+func writeRun(path string, it idIterator) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, runBufferSize)
+	var buf [8]byte
+	for {
+		id, ok, err := it.next()
+		if err != nil {
+			f.Close()
+			return err
+		} else if !ok {
+			break
+		}
+		binary.LittleEndian.PutUint64(buf[:], id)
+		w.Write(buf[:])
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// idIterator returns ids in increasing order.
+type idIterator interface {
+	// returns the next id, ok is false after the last one
+	next() (id uint64, ok bool, err error)
+}
+
+// returns the ids of a sorted slice
+type sliceIterator struct {
+	ids IdSet
+}
+
+func (s *sliceIterator) next() (uint64, bool, error) {
+	if len(s.ids) == 0 {
+		return 0, false, nil
+	}
+	id := s.ids[0]
+	s.ids = s.ids[1:]
+	return id, true, nil
+}
+
+// returns the ids of a channel, until it is closed or ctx is done
+type channelIterator struct {
+	ctx context.Context
+	c   <-chan uint64
+}
+
+func (c *channelIterator) next() (uint64, bool, error) {
+	id, ok := receive(c.ctx, c.c)
+	if !ok {
+		return 0, false, c.ctx.Err()
+	}
+	return id, true, nil
+}
+
+// reads the ids of a run file
+type runReader struct {
+	f   *os.File
+	r   *bufio.Reader
+	buf [8]byte
+}
+
+func openRun(path string) (*runReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &runReader{f: f, r: bufio.NewReaderSize(f, runBufferSize)}, nil
+}
+
+func (r *runReader) next() (uint64, bool, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err == io.EOF {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return binary.LittleEndian.Uint64(r.buf[:]), true, nil
+}
+
+func (r *runReader) Close() error {
+	return r.f.Close()
+}
+
+// merger merges many idIterators, each without repetitions.  Every id is
+// returned once, with the iterators it comes from.
+type merger struct {
+	its   []idIterator
+	heads []uint64
+	// the indexes of the iterators not exhausted, by head
+	order []int
+	from  []bool
+}
+
+func newMerger(its []idIterator) (*merger, error) {
+	m := &merger{its: its, heads: make([]uint64, len(its)), order: make([]int, 0, len(its)), from: make([]bool, len(its))}
+	for i, it := range its {
+		id, ok, err := it.next()
+		if err != nil {
+			return nil, err
+		} else if ok {
+			m.heads[i] = id
+			m.order = append(m.order, i)
+		}
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+func (m *merger) Len() int           { return len(m.order) }
+func (m *merger) Less(i, j int) bool { return m.heads[m.order[i]] < m.heads[m.order[j]] }
+func (m *merger) Swap(i, j int)      { m.order[i], m.order[j] = m.order[j], m.order[i] }
+func (m *merger) Push(x interface{}) { m.order = append(m.order, x.(int)) }
+func (m *merger) Pop() interface{} {
+	i := m.order[len(m.order)-1]
+	m.order = m.order[:len(m.order)-1]
+	return i
+}
+
+// returns the smallest id not returned yet and, for every iterator, whether
+// it holds the id.  from is only valid until the next call.
+func (m *merger) next() (id uint64, from []bool, ok bool, err error) {
+	if len(m.order) == 0 {
+		return 0, nil, false, nil
+	}
+	for i := range m.from {
+		m.from[i] = false
+	}
+	id = m.heads[m.order[0]]
+	for len(m.order) > 0 && m.heads[m.order[0]] == id {
+		i := m.order[0]
+		m.from[i] = true
+		if head, ok, err := m.its[i].next(); err != nil {
+			return 0, nil, false, err
+		} else if ok {
+			m.heads[i] = head
+			heap.Fix(m, 0)
+		} else {
+			heap.Pop(m)
+		}
+	}
+	return id, m.from, true, nil
+}
+
+// returns the ids of a merger, without repetitions
+type distinctIterator struct {
+	m *merger
+}
+
+func (d *distinctIterator) next() (uint64, bool, error) {
+	id, _, ok, err := d.m.next()
+	return id, ok, err
+}
@@ -0,0 +1,160 @@
+package twitterintersection
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// returns a channel of the ids in a random order
+func shuffledChannel(ids []uint64) <-chan uint64 {
+	shuffled := append([]uint64(nil), ids...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return IdsChannel(context.Background(), shuffled)
+}
+
+func TestDiskEngineSpillsRuns(t *testing.T) {
+	e := NewDiskEngine(t.TempDir(), 3)
+	ids := []uint64{5, 1, 3, 1, 9, 7, 3, 2, 8, 5}
+	runs, err := e.spill(context.Background(), filepath.Join(e.Dir, "a"), IdsChannel(context.Background(), ids))
+	if err != nil || len(runs) != 4 {
+		t.Fatal("expected 4 runs", runs, err)
+	}
+	r, err := openRun(runs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	first := make([]uint64, 0)
+	for id, ok, err := r.next(); ok || err != nil; id, ok, err = r.next() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = append(first, id)
+	}
+	if !reflect.DeepEqual(first, []uint64{1, 3, 5}) {
+		t.Error("the runs should be sorted", first)
+	}
+}
+
+func TestDiskEngineOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a, b, c := randomIdSet(r, 5000), randomIdSet(r, 5000), randomIdSet(r, 5000)
+	e := NewDiskEngine(t.TempDir(), 700)
+	ctx := context.Background()
+	read := func(ids <-chan uint64, errc <-chan error) IdSet {
+		s := IdSet(readUInt64Channel(ids))
+		if err := WaitErrors(errc); err != nil {
+			t.Error(err)
+		}
+		return s
+	}
+	if s := read(e.AtLeast(ctx, 3, shuffledChannel(a), shuffledChannel(b), shuffledChannel(c))); !reflect.DeepEqual(s, IntersectIdSets(a, b, c)) {
+		t.Error("bad intersection", len(s))
+	}
+	if s := read(e.AtLeast(ctx, 1, shuffledChannel(a), shuffledChannel(b), shuffledChannel(c))); !reflect.DeepEqual(s, UnionIdSets(a, b, c)) {
+		t.Error("bad union", len(s))
+	}
+	if s := read(e.AtLeast(ctx, 2, shuffledChannel(a), shuffledChannel(b), shuffledChannel(c))); !reflect.DeepEqual(s, AtLeastIdSets(2, a, b, c)) {
+		t.Error("bad atleast", len(s))
+	}
+	if s := read(e.Difference(ctx, shuffledChannel(a), shuffledChannel(b))); !reflect.DeepEqual(s, a.Difference(b)) {
+		t.Error("bad difference", len(s))
+	}
+	if s := read(e.SymmetricDifference(ctx, shuffledChannel(a), shuffledChannel(b))); !reflect.DeepEqual(s, a.SymmetricDifference(b)) {
+		t.Error("bad symmetric difference", len(s))
+	}
+	if s := read(e.AtLeast(ctx, 1, IdsChannel(ctx, nil), shuffledChannel(a))); !reflect.DeepEqual(s, a) {
+		t.Error("bad union with an empty set", len(s))
+	}
+	if entries, _ := os.ReadDir(e.Dir); len(entries) != 0 {
+		t.Error("the run files should be removed", entries)
+	}
+}
+
+func TestDiskEngineBoundedFanIn(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	a, b, c := randomIdSet(r, 2000), randomIdSet(r, 2000), randomIdSet(r, 2000)
+	e := NewDiskEngine(t.TempDir(), 100)
+	e.FanIn = 3
+	ids, errc := e.AtLeast(context.Background(), 2, shuffledChannel(a), shuffledChannel(b), shuffledChannel(c))
+	if s := IdSet(readUInt64Channel(ids)); !reflect.DeepEqual(s, AtLeastIdSets(2, a, b, c)) {
+		t.Error("bad atleast", len(s))
+	}
+	if err := WaitErrors(errc); err != nil {
+		t.Error(err)
+	}
+
+	ids, errc = e.AtLeast(context.Background(), 1, shuffledChannel(a), shuffledChannel(b), shuffledChannel(c), shuffledChannel(a))
+	if s := readUInt64Channel(ids); len(s) != 0 {
+		t.Error("expected no ids", len(s))
+	}
+	if err := WaitErrors(errc); err == nil {
+		t.Error("there are more operands than the fan-in")
+	}
+
+	e.FanIn = 1
+	ids, errc = e.AtLeast(context.Background(), 1, shuffledChannel(a), shuffledChannel(b))
+	readUInt64Channel(ids)
+	if err := WaitErrors(errc); err == nil {
+		t.Error("a fan-in below 2 cannot merge the runs")
+	}
+}
+
+func TestDiskEngineSpill(t *testing.T) {
+	e := NewDiskEngine(filepath.Join(t.TempDir(), "spill"), 10)
+	ids := []uint64{5, 1, 3, 9}
+	result, err := e.Spill(context.Background(), IdsChannel(context.Background(), ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idsC, errc := result.Ids(context.Background())
+	if s := readUInt64Channel(idsC); !reflect.DeepEqual(s, ids) {
+		t.Error("the ids should be read back in order", s)
+	}
+	if err := WaitErrors(errc); err != nil {
+		t.Error(err)
+	}
+	if err := result.Remove(); err != nil {
+		t.Error(err)
+	}
+	if files, _ := os.ReadDir(e.Dir); len(files) != 0 {
+		t.Error("the file should be removed", len(files))
+	}
+}
+
+func TestDiskEngineErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	e := NewDiskEngine(filepath.Join(file, "spill"), 10)
+	ids, errc := e.AtLeast(context.Background(), 2, countingChannel(100, 1), countingChannel(100, 2))
+	if s := readUInt64Channel(ids); len(s) != 0 {
+		t.Error("expected no ids", s)
+	}
+	if err := WaitErrors(errc); err == nil {
+		t.Error("expected an error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e = NewDiskEngine(t.TempDir(), 10)
+	ids, errc = e.AtLeast(ctx, 2, make(chan uint64), make(chan uint64))
+	readUInt64Channel(ids)
+	if err := WaitErrors(errc); err != context.Canceled {
+		t.Error("expected the error of the context", err)
+	}
+}
+
+func BenchmarkDiskIntersection1M(b *testing.B) {
+	e := NewDiskEngine(b.TempDir(), 1<<18)
+	for i := 0; i < b.N; i++ {
+		ids, errc := e.AtLeast(context.Background(), 2, countingChannel(1000000, 2), countingChannel(1000000, 3))
+		readUInt64Channel(ids)
+		if err := WaitErrors(errc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package twitterintersection
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// the formats of the stats command
+var StatsFormats = []string{"table", "csv", "json"}
+
+// the metrics of the matrix printed by the stats command
+var StatsMetrics = []string{"jaccard", "overlap", "intersection", "union"}
+
+// SetSize is the number of users of an operand of the stats command.
+type SetSize struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// PairStats is the overlap of the users of two operands.
+type PairStats struct {
+	A            string `json:"a"`
+	B            string `json:"b"`
+	Intersection int    `json:"intersection"`
+	Union        int    `json:"union"`
+	// the size of the intersection over the size of the union
+	Jaccard float64 `json:"jaccard"`
+	// the size of the intersection over the size of the smallest set
+	Overlap float64 `json:"overlap"`
+}
+
+// OverlapStats describes how much the users of many operands overlap.
+type OverlapStats struct {
+	Sets []*SetSize `json:"sets"`
+	// the number of users in every set and in at least one set
+	Intersection int          `json:"intersection"`
+	Union        int          `json:"union"`
+	Pairs        []*PairStats `json:"pairs"`
+}
+
+// returns a / b, or 0 when b is 0
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// NewPairStats returns the overlap of the sets a and b named nameA and nameB.
+func NewPairStats(nameA, nameB string, a, b IdSet) *PairStats {
+	intersection := len(a.Intersect(b))
+	union := len(a) + len(b) - intersection
+	smallest := len(a)
+	if len(b) < smallest {
+		smallest = len(b)
+	}
+	return &PairStats{nameA, nameB, intersection, union, ratio(intersection, union), ratio(intersection, smallest)}
+}
+
+// NewOverlapStats returns the sizes of the sets, named by names, of their
+// intersection and union and the overlap of every pair of sets.
+func NewOverlapStats(names []string, sets []IdSet) *OverlapStats {
+	stats := &OverlapStats{
+		Sets:         make([]*SetSize, len(sets)),
+		Intersection: len(IntersectIdSets(sets...)),
+		Union:        len(UnionIdSets(sets...)),
+		Pairs:        make([]*PairStats, 0),
+	}
+	for i, set := range sets {
+		stats.Sets[i] = &SetSize{names[i], len(set)}
+		for j := i + 1; j < len(sets); j++ {
+			stats.Pairs = append(stats.Pairs, NewPairStats(names[i], names[j], set, sets[j]))
+		}
+	}
+	return stats
+}
+
+// returns the stats of the pair i, j of sets, i and j may be equal
+func (s *OverlapStats) pair(i, j int) *PairStats {
+	if i == j {
+		size := s.Sets[i].Size
+		return &PairStats{s.Sets[i].Name, s.Sets[i].Name, size, size, ratio(size, size), ratio(size, size)}
+	} else if i > j {
+		i, j = j, i
+	}
+	// the pairs are ordered by i then j
+	n := len(s.Sets)
+	return s.Pairs[i*(2*n-i-1)/2+j-i-1]
+}
+
+// returns the value of metric for p as printed in the matrix
+func formatMetric(p *PairStats, metric string) string {
+	switch metric {
+	case "jaccard":
+		return strconv.FormatFloat(p.Jaccard, 'f', 4, 64)
+	case "overlap":
+		return strconv.FormatFloat(p.Overlap, 'f', 4, 64)
+	case "intersection":
+		return strconv.Itoa(p.Intersection)
+	case "union":
+		return strconv.Itoa(p.Union)
+	}
+	panic("unknown metric " + metric)
+}
+
+// returns the rows of the matrix of metric, headers included
+func (s *OverlapStats) matrix(metric string) [][]string {
+	header := []string{"set", "size"}
+	for _, set := range s.Sets {
+		header = append(header, set.Name)
+	}
+	rows := [][]string{header}
+	for i, set := range s.Sets {
+		row := []string{set.Name, strconv.Itoa(set.Size)}
+		for j := range s.Sets {
+			row = append(row, formatMetric(s.pair(i, j), metric))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteStats writes the matrix of metric, one of the StatsMetrics, in one of
+// the StatsFormats.  The json format holds every metric.
+func WriteStats(w io.Writer, stats *OverlapStats, format, metric string) error {
+	if !containsString(StatsMetrics, metric) {
+		return errors.New("unknown metric " + metric + ", should be one of " + strings.Join(StatsMetrics, ", "))
+	}
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+		for _, row := range stats.matrix(metric) {
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+		fmt.Fprintf(tw, "\nintersection of all\t%v\t\nunion of all\t%v\t\n", stats.Intersection, stats.Union)
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.WriteAll(stats.matrix(metric))
+		return cw.Error()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	return errors.New("unknown format " + format + ", should be one of " + strings.Join(StatsFormats, ", "))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryStats returns the overlap of the users of the queries, every query
+// is read in memory.
+func QueryStats(ctx context.Context, followerGetter FollowerGetter, queries []Expr) (*OverlapStats, error) {
+	names := make([]string, len(queries))
+	cs := make([]<-chan uint64, len(queries))
+	errcs := make([]<-chan error, len(queries))
+	for i, query := range queries {
+		names[i] = query.String()
+		cs[i], errcs[i] = query.Eval(ctx, followerGetter, MemoryEngine{})
+	}
+	sets := collect(ctx, cs...)
+	if err := WaitErrors(errcs...); err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return NewOverlapStats(names, sets), nil
+}
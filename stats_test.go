@@ -0,0 +1,99 @@
+package twitterintersection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewPairStats(t *testing.T) {
+	p := NewPairStats("a", "b", IdSet{1, 2, 3, 4}, IdSet{3, 4, 5})
+	expected := &PairStats{"a", "b", 2, 5, 0.4, 2.0 / 3}
+	if !reflect.DeepEqual(p, expected) {
+		t.Error("bad stats", p)
+	}
+	if p := NewPairStats("a", "b", IdSet{}, IdSet{}); p.Jaccard != 0 || p.Overlap != 0 {
+		t.Error("empty sets should not overlap", p)
+	}
+}
+
+func TestNewOverlapStats(t *testing.T) {
+	stats := NewOverlapStats([]string{"a", "b", "c", "d"}, []IdSet{{1, 2, 3, 4}, {3, 4, 5}, {4, 6}, {4, 7}})
+	if stats.Intersection != 1 || stats.Union != 7 || len(stats.Pairs) != 6 {
+		t.Fatal("bad stats", stats)
+	}
+	for i := range stats.Sets {
+		for j := range stats.Sets {
+			if p := stats.pair(i, j); (p.A != stats.Sets[i].Name || p.B != stats.Sets[j].Name) && (p.A != stats.Sets[j].Name || p.B != stats.Sets[i].Name) {
+				t.Error("bad pair of", i, j, p)
+			}
+		}
+	}
+	if p := stats.pair(2, 1); p.Intersection != 1 || p.Union != 4 {
+		t.Error("bad pair", p)
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	stats := NewOverlapStats([]string{"a", "b"}, []IdSet{{1, 2, 3, 4}, {3, 4, 5}})
+	var buf bytes.Buffer
+	if err := WriteStats(&buf, stats, "csv", "jaccard"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "set,size,a,b\na,4,1.0000,0.4000\nb,3,0.4000,1.0000\n"; buf.String() != expected {
+		t.Error("bad csv", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteStats(&buf, stats, "table", "intersection"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) < 3 || strings.Fields(lines[1])[3] != "2" || !strings.Contains(buf.String(), "union of all  5") {
+		t.Error("bad table", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteStats(&buf, stats, "json", "jaccard"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded OverlapStats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || !reflect.DeepEqual(&decoded, stats) {
+		t.Error("bad json", buf.String(), err)
+	}
+
+	if err := WriteStats(&buf, stats, "xml", "jaccard"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if err := WriteStats(&buf, stats, "csv", "cosine"); err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	fg := mapFollowerGetter{
+		"a": {1, 2, 3, 4},
+		"b": {3, 4, 5},
+		"c": {4, 6},
+	}
+	queries := make([]Expr, 0)
+	for _, query := range []string{"a", "b", "a | c"} {
+		expr, _ := ParseQuery(query)
+		queries = append(queries, expr)
+	}
+	stats, err := QueryStats(context.Background(), fg, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Sets[2].Name != "(a | c)" || stats.Sets[2].Size != 5 || stats.Intersection != 2 || stats.Union != 6 {
+		t.Error("bad stats", stats.Sets, stats.Intersection, stats.Union)
+	}
+
+	failing := &failingPagesGetter{MockFollowerGetter{t}, map[string]error{"b": NewTwitterErr("Not authorized.", 401)}}
+	if _, err := QueryStats(context.Background(), failing, queries); err == nil {
+		t.Error("expected the error of the follower getter")
+	}
+}
@@ -1,94 +1,250 @@
-package main
+package twitterintersection
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
 	"sync"
 )
 
+// FollowerGetter fetches pages of the users in relation with accounts.  A
+// page or a lookup that cannot be fetched carries the error in its Err field.
+// The requests are cancelled when ctx is done.
 type FollowerGetter interface {
-	GetFollowerByCursor(screenName, cursor string) <-chan *FollowerList
-	GetFollowerIdsByCursor(screenName, cursor string) <-chan *FollowerIDList
-	GetScreenNameOfUsersByIds(ids []uint64) <-chan string
+	GetUsersByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerList
+	GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList
+	LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup
 }
 
-func GetFollowerScreenNames(followerGetter FollowerGetter, screenName string) <-chan string {
+func GetFollowerScreenNames(ctx context.Context, followerGetter FollowerGetter, screenName string) (<-chan string, <-chan error) {
+	return GetScreenNames(ctx, followerGetter, Followers, screenName)
+}
+
+func GetFriendScreenNames(ctx context.Context, followerGetter FollowerGetter, screenName string) (<-chan string, <-chan error) {
+	return GetScreenNames(ctx, followerGetter, Friends, screenName)
+}
+
+// returns the error to report when a page of the users in relation with
+// screenName cannot be fetched: the error of ctx if it is done, an
+// AccountErr otherwise
+func pageErr(ctx context.Context, relation Relation, screenName string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &AccountErr{screenName, relation, err}
+}
+
+// returns the screen names of all the users in relation with the account
+// screenName.  On error, the screen names stop and the error, an AccountErr,
+// is sent on the error channel.  Both channels are closed at the end.
+func GetScreenNames(ctx context.Context, followerGetter FollowerGetter, relation Relation, screenName string) (<-chan string, <-chan error) {
 	followerC := make(chan string)
+	errc := make(chan error, 1)
 	go func() {
+		defer close(errc)
+		defer close(followerC)
 		nextCursor := "-1"
 		for nextCursor != "0" && nextCursor != "" {
-			followers := <-followerGetter.GetFollowerByCursor(screenName, nextCursor)
+			followers := <-followerGetter.GetUsersByCursor(ctx, relation, screenName, nextCursor)
+			if followers.Err != nil {
+				errc <- pageErr(ctx, relation, screenName, followers.Err)
+				return
+			}
 			nextCursor = followers.NextCursor
 			for _, follower := range followers.GetFollowerScreenNames() {
-				followerC <- follower
+				select {
+				case followerC <- follower:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
 			}
 		}
-		close(followerC)
 	}()
-	return followerC
+	return followerC, errc
+}
+
+func GetFollowerIds(ctx context.Context, followerGetter FollowerGetter, screenName string) (<-chan uint64, <-chan error) {
+	return GetIds(ctx, followerGetter, Followers, screenName)
+}
+
+func GetFriendIds(ctx context.Context, followerGetter FollowerGetter, screenName string) (<-chan uint64, <-chan error) {
+	return GetIds(ctx, followerGetter, Friends, screenName)
 }
 
-func GetFollowerIds(followerGetter FollowerGetter, screenName string) <-chan uint64 {
+// returns the ids of all the users in relation with the account screenName.
+// On error, the ids stop and the error, an AccountErr, is sent on the error
+// channel.  Both channels are closed at the end.
+func GetIds(ctx context.Context, followerGetter FollowerGetter, relation Relation, screenName string) (<-chan uint64, <-chan error) {
+	return getIds(ctx, followerGetter, relation, screenName, screenName)
+}
+
+// GetIds, with the AccountErr naming the account name instead of the
+// account fetched, such as the screen name of a resolved id
+func getIds(ctx context.Context, followerGetter FollowerGetter, relation Relation, screenName, name string) (<-chan uint64, <-chan error) {
 	followerC := make(chan uint64)
+	errc := make(chan error, 1)
 	go func() {
+		defer close(errc)
+		defer close(followerC)
 		nextCursor := "-1"
 		for nextCursor != "0" && nextCursor != "" {
-			followers := <-followerGetter.GetFollowerIdsByCursor(screenName, nextCursor)
+			followers := <-followerGetter.GetIdsByCursor(ctx, relation, screenName, nextCursor)
+			if followers.Err != nil {
+				errc <- pageErr(ctx, relation, name, followers.Err)
+				return
+			}
 			nextCursor = followers.NextCursor
 			for _, follower := range followers.Followers {
-				followerC <- follower
+				if !send(ctx, followerC, follower) {
+					errc <- ctx.Err()
+					return
+				}
 			}
 		}
-		close(followerC)
 	}()
-	return followerC
+	return followerC, errc
 }
 
-func GetScreenNameByIds(followerGetter FollowerGetter, idsC <-chan uint64) <-chan string {
-	screenNameC := make(chan string)
+// calls produce in its own goroutine for every batch of ids of idsC, then
+// calls finish once all the calls returned.  No more batches are produced
+// once ctx is done, or once stop returns true, in which case the ids of idsC
+// are still read.
+func forEachBatchOfIds(ctx context.Context, idsC <-chan uint64, stop func() bool, produce func(buffer []uint64), finish func()) {
 	var wg sync.WaitGroup
-
-	produceScreenName := func(buffer []uint64) {
-		for screenName := range followerGetter.GetScreenNameOfUsersByIds(buffer) {
-			screenNameC <- screenName
-		}
-		wg.Done()
-	}
-
 	go func() {
 		buffer := make([]uint64, 0, 100)
-		for id := range idsC {
+		for id, ok := receive(ctx, idsC); ok; id, ok = receive(ctx, idsC) {
+			if stop() {
+				continue
+			}
 			buffer = append(buffer, id)
 			if len(buffer) >= 95 {
 				wg.Add(1)
-				go produceScreenName(buffer)
+				go func(buffer []uint64) {
+					produce(buffer)
+					wg.Done()
+				}(buffer)
 				buffer = make([]uint64, 0, 100)
 			}
 		}
-		wg.Add(1)
-		go produceScreenName(buffer)
-		go func() {
-			wg.Wait()
-			close(screenNameC)
-		}()
+		if len(buffer) > 0 && ctx.Err() == nil && !stop() {
+			wg.Add(1)
+			go func() {
+				produce(buffer)
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		finish()
 	}()
-	return screenNameC
 }
 
-func GetFollowerIdsOfBothAccounts(followerGetter FollowerGetter, screenName1, screenName2 string) <-chan uint64 {
-	return Intersection(GetFollowerIds(followerGetter, screenName1), GetFollowerIds(followerGetter, screenName1))
+// returns the screen names of the users of idsC, the suspended or deleted
+// users left out.  The first lookup error is sent on the error channel.
+func GetScreenNameByIds(ctx context.Context, followerGetter FollowerGetter, idsC <-chan uint64) (<-chan string, <-chan error) {
+	screenNameC := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(screenNameC)
+		lookupC, lookupErrc := LookupUsers(ctx, followerGetter, idsC)
+		for lookup := range lookupC {
+			if lookup.Missing() {
+				continue
+			}
+			select {
+			case screenNameC <- lookup.User.ScreenName:
+			case <-ctx.Done():
+			}
+		}
+		if err := <-lookupErrc; err != nil {
+			errc <- err
+		}
+	}()
+	return screenNameC, errc
+}
+
+// LookupUsers returns the lookup of every id of idsC, the suspended or
+// deleted users included.  Once a batch fails, no more lookups are sent and
+// its error is sent on the error channel, the remaining ids of idsC are
+// still read.  When ctx is done, the lookups stop and its error is sent.
+func LookupUsers(ctx context.Context, followerGetter FollowerGetter, idsC <-chan uint64) (<-chan *UserLookup, <-chan error) {
+	lookupC := make(chan *UserLookup)
+	errc := make(chan error, 1)
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	forEachBatchOfIds(ctx, idsC, failed, func(buffer []uint64) {
+		for lookup := range followerGetter.LookupUsersOfIds(ctx, buffer) {
+			mu.Lock()
+			if lookup.Err != nil && firstErr == nil {
+				firstErr = lookup.Err
+			}
+			stopped := firstErr != nil
+			mu.Unlock()
+			if stopped {
+				continue
+			}
+			select {
+			case lookupC <- lookup:
+			case <-ctx.Done():
+			}
+		}
+	}, func() {
+		close(lookupC)
+		if ctx.Err() != nil {
+			errc <- ctx.Err()
+		} else if firstErr != nil {
+			errc <- firstErr
+		}
+		close(errc)
+	})
+	return lookupC, errc
+}
+
+func GetFollowerIdsOfAllAccounts(ctx context.Context, followerGetter FollowerGetter, screenNames ...string) (<-chan uint64, <-chan error) {
+	followerCs := make([]<-chan uint64, len(screenNames))
+	errcs := make([]<-chan error, len(screenNames))
+	for i, screenName := range screenNames {
+		followerCs[i], errcs[i] = GetFollowerIds(ctx, followerGetter, screenName)
+	}
+	return Intersection(ctx, followerCs...), mergeErrors(errcs...)
 }
 
-func main() {
-	if len(os.Args) != 3 {
-		log.Println("you need to specify the name of exactly two twitter account names at parameter")
-		return
+// NewTwitterApiFromCredentials returns a TwitterApi authenticated in the
+// user context when the credentials hold an access token, with a bearer token
+// requested for the application otherwise.
+func NewTwitterApiFromCredentials(ctx context.Context, credentials *Credentials, opts ...Option) (*TwitterApi, error) {
+	o := newOptions(opts)
+	if credentials.HasUserContext() {
+		signer := NewOAuth1Signer(credentials.ConsumerKey, credentials.ConsumerSecret, credentials.AccessToken, credentials.AccessTokenSecret)
+		return NewUserContextTwitterApi(o.apiUrl, signer, opts...), nil
+	}
+	token, err := RequestBearerToken(ctx, o.oauth2Url, credentials, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain a bearer token: %w", err)
+	}
+	return NewTwitterApi(o.apiUrl, token, opts...), nil
+}
+
+// NewFollowerGetterFromCredentials returns a FollowerGetter that uses all the
+// credentials, through a TokenPool when there are many of them, and the
+// TwitterApi of every credentials.
+func NewFollowerGetterFromCredentials(ctx context.Context, list []*Credentials, opts ...Option) (FollowerGetter, []*TwitterApi, error) {
+	apis := make([]*TwitterApi, len(list))
+	for i, credentials := range list {
+		t, err := NewTwitterApiFromCredentials(ctx, credentials, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		apis[i] = t
 	}
-	token := "AAAAAAAAAAAAAAAAAAAAAPwfcQAAAAAAzkou%2FHjJNJmwdepeRq0c%2Bi3Nx6o%3DXofLt7SVvc99ulETLRA3yS2lYo8smfc6tACxEYsLUmGsrNbc9J"
-	t := NewTwitterApi(TWITTER_API_URL, token)
-	followers := Intersection(GetFollowerIds(t, os.Args[1]), GetFollowerIds(t, os.Args[2]))
-	for screenName := range GetScreenNameByIds(t, followers) {
-		fmt.Println(screenName)
+	if len(apis) == 1 {
+		return apis[0], apis, nil
 	}
+	return NewTokenPool(apis...), apis, nil
 }
@@ -1,7 +1,8 @@
-package main
+package twitterintersection
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,19 +12,85 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const TWITTER_API_URL = "https://api.twitter.com/1.1"
 
+// the number of ids and of users requested per page, the most twitter
+// accepts
+const (
+	DEFAULT_IDS_PAGE_SIZE   = 5000
+	DEFAULT_USERS_PAGE_SIZE = 200
+)
+
 type TwitterApi struct {
 	BaseUrl     string
 	AccessToken string
+
+	// when not nil, the requests are signed on behalf of a user instead of
+	// being authenticated with the bearer token
+	Signer *OAuth1Signer
+
+	// when not nil, the requests are held until the budget of their
+	// endpoint allows them
+	RateLimits *RateLimiter
+
+	// when not nil, the requests failing with a transient error are sent
+	// again
+	Retry *RetryPolicy
+
+	Client *http.Client
+	// when not empty, the User-Agent header of the requests
+	UserAgent string
+
+	// the number of ids and of users requested per page, the defaults when
+	// zero
+	IdsPageSize   int
+	UsersPageSize int
+}
+
+func NewTwitterApi(baseUrl, accesToken string, opts ...Option) *TwitterApi {
+	o := newOptions(opts)
+	rateLimits := NewRateLimiter()
+	rateLimits.MaxWait = o.maxWait
+	return &TwitterApi{
+		BaseUrl:       baseUrl,
+		AccessToken:   accesToken,
+		RateLimits:    rateLimits,
+		Retry:         o.retry,
+		Client:        o.httpClient(),
+		UserAgent:     o.userAgent,
+		IdsPageSize:   o.idsPageSize,
+		UsersPageSize: o.usersPageSize,
+	}
 }
 
-func NewTwitterApi(baseUrl, accesToken string) *TwitterApi {
-	return &TwitterApi{baseUrl, accesToken}
+// returns a TwitterApi that authenticates its requests in the user context
+func NewUserContextTwitterApi(baseUrl string, signer *OAuth1Signer, opts ...Option) *TwitterApi {
+	t := NewTwitterApi(baseUrl, "", opts...)
+	t.Signer = signer
+	return t
+}
+
+func (t *TwitterApi) authorize(req *http.Request, form url.Values) {
+	if t.Signer != nil {
+		t.Signer.Sign(req, form)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+	}
+}
+
+func (t *TwitterApi) do(req *http.Request) (*http.Response, error) {
+	if t.UserAgent != "" {
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
 }
 
 func (t *TwitterApi) encodeParams(params map[string]string) string {
@@ -56,148 +123,270 @@ func (t *TwitterApi) createGetPathAndParams(apiEndpoint string, params map[strin
 	return u.String()
 }
 
+// returns the credentials to send, as basic authentication, to the oauth2
+// endpoints
 func (t *TwitterApi) GetBase64EncodedBearerTokenCredentials(consumerKey, consumerSecret string) string {
-	data := []byte(consumerKey + ":" + consumerSecret)
-	return base64.URLEncoding.EncodeToString(data)
+	data := []byte(url.QueryEscape(consumerKey) + ":" + url.QueryEscape(consumerSecret))
+	return base64.StdEncoding.EncodeToString(data)
 }
 
-func (t *TwitterApi) Get(path_ string) (resp *http.Response, err error) {
-	req, err := http.NewRequest("GET", t.BaseUrl+path_, nil)
+func (t *TwitterApi) Get(ctx context.Context, path_ string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.BaseUrl+path_, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+	t.authorize(req, nil)
 	req.Header.Set("content-type", "application/json; charset=utf-8")
-	return http.DefaultClient.Do(req)
+	return t.do(req)
 }
 
-func (t *TwitterApi) Post(path_ string, body string) (resp *http.Response, err error) {
-	req, err := http.NewRequest("POST", t.BaseUrl+path_, bytes.NewBufferString(body))
+func (t *TwitterApi) Post(ctx context.Context, path_ string, body string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", t.BaseUrl+path_, bytes.NewBufferString(body))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+	form, _ := url.ParseQuery(body)
+	t.authorize(req, form)
 	req.Header.Set("content-type", "application/x-www-form-urlencoded")
-	return http.DefaultClient.Do(req)
+	return t.do(req)
 }
 
-func (t *TwitterApi) GetAndDeserialize(path string, params map[string]string, v interface{}) (err error) {
-	defer func() {
-		if err == io.EOF {
-			err = nil
-		}
-	}()
-	if r, err := t.Get(t.createGetPathAndParams(path, params)); err != nil {
-		return err
-	} else if r.StatusCode/100 != 2 {
-		if errMsg, err := ioutil.ReadAll(r.Body); err != nil {
-			return errors.New("error getting endpoint and cannot deserialize error message")
-		} else {
-			return NewTwitterErr(string(errMsg), r.StatusCode)
-		}
-	} else {
-		d := json.NewDecoder(r.Body)
-		return d.Decode(v)
-	}
+// sends the request made by do and deserializes its response in v.  The
+// request is sent again, according to the retry policy, when it fails with a
+// transient error.
+func (t *TwitterApi) deserialize(ctx context.Context, endpoint string, do func() (*http.Response, error), v interface{}) error {
+	return t.Retry.Do(ctx, endpoint, func() error {
+		return t.deserializeOnce(ctx, endpoint, do, v)
+	})
 }
 
-func (t *TwitterApi) PostAndDeserialize(path string, params map[string]string, v interface{}) (err error) {
+// sends the request made by do, waiting before if the budget of endpoint is
+// exhausted, and deserializes its response in v.  The request is sent again
+// when twitter refuses it because of its rate limit, unless it comes from a
+// TokenPool, to which it is returned.
+func (t *TwitterApi) deserializeOnce(ctx context.Context, endpoint string, do func() (*http.Response, error), v interface{}) (err error) {
 	defer func() {
 		if err == io.EOF {
 			err = nil
 		}
 	}()
-	if r, err := t.Post(path, t.encodeParams(params)); err != nil {
-		return err
-	} else if r.StatusCode/100 != 2 {
-		if errMsg, err := ioutil.ReadAll(r.Body); err != nil {
+	budget := poolBudgetOf(ctx)
+	for {
+		if budget == nil || !budget.reserved.CompareAndSwap(true, false) {
+			if err := t.RateLimits.Wait(ctx, endpoint); err != nil {
+				return err
+			}
+		}
+		r, err := do()
+		if err != nil {
+			return err
+		}
+		t.RateLimits.Update(endpoint, r.Header)
+		if r.StatusCode/100 == 2 {
+			defer r.Body.Close()
+			d := json.NewDecoder(r.Body)
+			return d.Decode(v)
+		}
+		errMsg, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
 			return errors.New("error getting endpoint and cannot deserialize error message")
-		} else {
-			return NewTwitterErr(string(errMsg), r.StatusCode)
 		}
-	} else {
-		d := json.NewDecoder(r.Body)
-		return d.Decode(v)
+		twitterErr := NewTwitterErr(string(errMsg), r.StatusCode)
+		if IsRateLimited(twitterErr) && t.RateLimits != nil {
+			log.Println("api limit reached on", endpointFamily(endpoint))
+			t.RateLimits.Exhausted(endpoint)
+			if budget == nil {
+				continue
+			}
+			// returned to the pool, which sends it with another token
+		}
+		return twitterErr
 	}
 }
 
-func (t *TwitterApi) GetTwitterIdByScreenName(sceenName string) (id uint64, err error) {
-	ids := make([]*idHolder, 0, 1)
-	params := map[string]string{"screen_name": sceenName, "include_entities": "id"}
-	apiPath := "/users/lookup.json"
-	if err := t.GetAndDeserialize(apiPath, params, &ids); err != nil {
+func (t *TwitterApi) GetAndDeserialize(ctx context.Context, path string, params map[string]string, v interface{}) error {
+	return t.deserialize(ctx, path, func() (*http.Response, error) {
+		return t.Get(ctx, t.createGetPathAndParams(path, params))
+	}, v)
+}
+
+func (t *TwitterApi) PostAndDeserialize(ctx context.Context, path string, params map[string]string, v interface{}) error {
+	return t.deserialize(ctx, path, func() (*http.Response, error) {
+		return t.Post(ctx, path, t.encodeParams(params))
+	}, v)
+}
+
+// GetTwitterIdByScreenName returns the id of the user with the screen name.
+func (t *TwitterApi) GetTwitterIdByScreenName(ctx context.Context, screenName string) (id uint64, err error) {
+	ids, err := t.ResolveScreenNames(ctx, []string{screenName})
+	if err != nil {
 		return 0, err
-	} else if len(ids) < 1 {
-		return 0, errors.New("cannot find user with screen name " + sceenName)
+	} else if id, ok := ids[strings.ToLower(screenName)]; ok {
+		return id, nil
+	}
+	return 0, errors.New("cannot find user with screen name " + screenName)
+}
+
+// FetchUsersByScreenNames returns the users with the given screen names.
+// twitter does not support more than 100 screen names per request.
+func (t *TwitterApi) FetchUsersByScreenNames(ctx context.Context, screenNames []string) ([]*User, error) {
+	params := map[string]string{"screen_name": strings.Join(screenNames, ",")}
+	users := make([]*User, 0, len(screenNames))
+	if err := t.PostAndDeserialize(ctx, "/users/lookup.json", params, &users); err != nil {
+		return nil, err
 	}
-	return ids[0].Id, nil
+	return users, nil
 }
 
-func (t *TwitterApi) GetFollowerByCursor(screenName, cursor string) <-chan *FollowerList {
+// ResolveScreenNames returns the ids of the users with the screen names,
+// keyed by screen name in lower case, fetched by batches of 100.
+func (t *TwitterApi) ResolveScreenNames(ctx context.Context, screenNames []string) (map[string]uint64, error) {
+	return resolveByBatches(screenNames, func(batch []string) ([]*User, error) {
+		return t.FetchUsersByScreenNames(ctx, batch)
+	})
+}
+
+// returns the count parameter of a page of size, or of defaultSize when
+// size is zero
+func pageSize(size, defaultSize int) string {
+	if size <= 0 {
+		size = defaultSize
+	}
+	return strconv.Itoa(size)
+}
+
+// FetchUsers returns a page of the users in relation with the account
+// screenName, a screen name or an IdAccount.
+func (t *TwitterApi) FetchUsers(ctx context.Context, relation Relation, screenName, cursor string) (*FollowerList, error) {
+	params := accountParams(screenName, map[string]string{"count": pageSize(t.UsersPageSize, DEFAULT_USERS_PAGE_SIZE), "skip_status": "true", "cursor": cursor})
+	apiPath := "/" + string(relation) + "/list.json"
+	followers := new(FollowerList)
+	if err := t.GetAndDeserialize(ctx, apiPath, params, followers); err != nil {
+		return nil, err
+	}
+	return followers, nil
+}
+
+// FetchIds returns a page of the ids of the users in relation with the
+// account screenName, a screen name or an IdAccount.
+func (t *TwitterApi) FetchIds(ctx context.Context, relation Relation, screenName, cursor string) (*FollowerIDList, error) {
+	params := accountParams(screenName, map[string]string{"count": pageSize(t.IdsPageSize, DEFAULT_IDS_PAGE_SIZE), "cursor": cursor})
+	apiPath := "/" + string(relation) + "/ids.json"
+	followers := new(FollowerIDList)
+	if err := t.GetAndDeserialize(ctx, apiPath, params, followers); err != nil {
+		return nil, err
+	}
+	return followers, nil
+}
+
+// FetchUsersByIds returns the users with the given ids.  twitter does not
+// support more than 100 ids per request.
+func (t *TwitterApi) FetchUsersByIds(ctx context.Context, ids []uint64) ([]*User, error) {
+	if len(ids) >= 100 {
+		log.Println("FetchUsersByIds received a list of more that 100 ids.  This is not supported by twitter")
+	}
+	path := "/users/lookup.json"
+	params := map[string]string{"user_id": t.asCommaSeparatedString(ids)}
+	users := make([]*User, 0, len(ids))
+	if err := t.PostAndDeserialize(ctx, path, params, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// returns a page of the users in relation with the account screenName
+func (t *TwitterApi) GetUsersByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerList {
 	followerListC := make(chan *FollowerList)
 	go func() {
-		params := map[string]string{"screen_name": screenName, "count": "200", "skip_status": "true", "cursor": cursor}
-		apiPath := "/followers/list.json"
-		followers := new(FollowerList)
-		if err := t.GetAndDeserialize(apiPath, params, followers); err == nil {
+		if followers, err := t.FetchUsers(ctx, relation, screenName, cursor); err == nil {
 			followerListC <- followers
-		} else if twitterErr, ok := err.(*TwitterErr); ok && twitterErr.Status == 429 {
-			log.Println("api limit reached, need to sleep")
-			time.Sleep(5 * 60 * time.Second)
-			followerListC <- <-t.GetFollowerByCursor(screenName, cursor)
 		} else {
-			log.Println(err)
-			followerListC <- nil
+			followerListC <- &FollowerList{Err: err}
 		}
 	}()
 	return followerListC
 }
 
-func (t *TwitterApi) GetFollowerIdsByCursor(screenName, cursor string) <-chan *FollowerIDList {
+// returns a page of the ids of the users in relation with the account
+// screenName
+func (t *TwitterApi) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
 	followerListC := make(chan *FollowerIDList)
 
 	go func() {
-		params := map[string]string{"screen_name": screenName, "count": "5000", "cursor": cursor}
-		apiPath := "/followers/ids.json"
-		followers := new(FollowerIDList)
-		if err := t.GetAndDeserialize(apiPath, params, followers); err == nil {
+		if followers, err := t.FetchIds(ctx, relation, screenName, cursor); err == nil {
 			followerListC <- followers
-		} else if twitterErr, ok := err.(*TwitterErr); ok && twitterErr.Status == 429 {
-			log.Println("api limit reached, need to sleep")
-			time.Sleep(5 * 60 * time.Second)
-			followerListC <- <-t.GetFollowerIdsByCursor(screenName, cursor)
 		} else {
-			log.Println(err)
-			followerListC <- nil
+			followerListC <- &FollowerIDList{Err: err}
 		}
 	}()
 
 	return followerListC
 }
 
-func (t *TwitterApi) GetScreenNameOfUsersByIds(ids []uint64) <-chan string {
-	if len(ids) >= 100 {
-		log.Println("GetScreenNameOfUsersByIds received a list of more that 100 ids.  This is not supported by twitter")
+func (t *TwitterApi) GetFollowerByCursor(ctx context.Context, screenName, cursor string) <-chan *FollowerList {
+	return t.GetUsersByCursor(ctx, Followers, screenName, cursor)
+}
+
+func (t *TwitterApi) GetFollowerIdsByCursor(ctx context.Context, screenName, cursor string) <-chan *FollowerIDList {
+	return t.GetIdsByCursor(ctx, Followers, screenName, cursor)
+}
+
+func (t *TwitterApi) GetFriendByCursor(ctx context.Context, screenName, cursor string) <-chan *FollowerList {
+	return t.GetUsersByCursor(ctx, Friends, screenName, cursor)
+}
+
+func (t *TwitterApi) GetFriendIdsByCursor(ctx context.Context, screenName, cursor string) <-chan *FollowerIDList {
+	return t.GetIdsByCursor(ctx, Friends, screenName, cursor)
+}
+
+// HydrateUsers returns the users with the given ids keyed by id.  The
+// suspended and deleted users are absent of the map.  twitter does not
+// support more than 100 ids per request.
+func (t *TwitterApi) HydrateUsers(ctx context.Context, ids []uint64) (map[uint64]*User, error) {
+	users, err := t.FetchUsersByIds(ctx, ids)
+	if IsNotFound(err) {
+		// none of the users exist
+		return make(map[uint64]*User), nil
+	} else if err != nil {
+		return nil, err
 	}
-	screenNameC := make(chan string)
-	go func() {
-		path := "/users/lookup.json"
-		params := map[string]string{"user_id": t.asCommaSeparatedString(ids)}
-		users := make([]*User, 0, len(ids))
-		if err := t.PostAndDeserialize(path, params, &users); err == nil {
-			for _, user := range users {
-				screenNameC <- user.ScreenName
-			}
-		} else if twitterErr, ok := err.(*TwitterErr); ok && twitterErr.Status == 429 {
-			log.Println("api limit reached, need to sleep")
-			time.Sleep(5 * 60 * time.Second)
-			screenNameC <- <-t.GetScreenNameOfUsersByIds(ids)
-		} else {
-			log.Println(err)
-			screenNameC <- ""
-		}
-		close(screenNameC)
+	return usersById(users), nil
+}
+
+func usersById(users []*User) map[uint64]*User {
+	m := make(map[uint64]*User, len(users))
+	for _, user := range users {
+		m[user.Id] = user
+	}
+	return m
+}
 
+func (t *TwitterApi) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	lookupC := make(chan *UserLookup)
+	go func() {
+		users, err := t.HydrateUsers(ctx, ids)
+		sendLookups(ctx, lookupC, ids, users, err)
 	}()
-	return screenNameC
+	return lookupC
+}
+
+// sends the lookup of every id in lookupC and closes it.  On error, a single
+// lookup carrying the error is sent.  The sending stops when ctx is done.
+func sendLookups(ctx context.Context, lookupC chan<- *UserLookup, ids []uint64, users map[uint64]*User, err error) {
+	defer close(lookupC)
+	lookups := []*UserLookup{{Err: err}}
+	if err == nil {
+		lookups = make([]*UserLookup, len(ids))
+		for i, id := range ids {
+			lookups[i] = &UserLookup{Id: id, User: users[id]}
+		}
+	}
+	for _, lookup := range lookups {
+		select {
+		case lookupC <- lookup:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
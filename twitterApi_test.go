@@ -1,15 +1,22 @@
-package main
+package twitterintersection
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func TestcreateGetPathAndParams(t *testing.T) {
+func TestCreateGetPathAndParams(t *testing.T) {
 	tw := NewTwitterApi("twitter.com", "access_token")
 	p := map[string]string{"hello": "world"}
 	if u := tw.createGetPathAndParams("bob/foo", p); u != "bob/foo?hello=world" {
@@ -49,7 +56,7 @@ func TestGet(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 
-	if res, err := tw.Get("/"); err != nil {
+	if res, err := tw.Get(context.Background(), "/"); err != nil {
 		t.Error(err)
 	} else {
 		ioutil.ReadAll(res.Body)
@@ -76,7 +83,7 @@ func TestPost(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 
-	if res, err := tw.Post("/", `{"data": "is_hugue"}`); err != nil {
+	if res, err := tw.Post(context.Background(), "/", `{"data": "is_hugue"}`); err != nil {
 		t.Error(err)
 	} else {
 		ioutil.ReadAll(res.Body)
@@ -91,7 +98,7 @@ func TestGetAndDeserializeError(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 	m := make(map[string]string)
-	if err := tw.GetAndDeserialize("/foo", map[string]string{}, &m); err == nil {
+	if err := tw.GetAndDeserialize(context.Background(), "/foo", map[string]string{}, &m); err == nil {
 		t.Error("shoud have an error message here")
 	} else if err.Error() != `{"error": "bar"}` {
 		t.Error("error message should propagate here")
@@ -112,7 +119,7 @@ func TestGetAndDeserialize(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 	m := make(map[string]string)
-	if err := tw.GetAndDeserialize("/foo", map[string]string{"foo": "bar"}, &m); err != nil {
+	if err := tw.GetAndDeserialize(context.Background(), "/foo", map[string]string{"foo": "bar"}, &m); err != nil {
 		t.Error(err)
 	}
 	if m["foo"] != "bar" {
@@ -133,7 +140,7 @@ func TestPostAndDeserialize(t *testing.T) {
 	tw := NewTwitterApi(ts.URL, "access_token")
 	m := make(map[string]string)
 
-	if err := tw.PostAndDeserialize("/foo", map[string]string{"val": "7"}, &m); err != nil {
+	if err := tw.PostAndDeserialize(context.Background(), "/foo", map[string]string{"val": "7"}, &m); err != nil {
 		t.Error(err)
 	}
 	if m["foo"] != "bar" {
@@ -143,20 +150,82 @@ func TestPostAndDeserialize(t *testing.T) {
 
 func TestGetTwitterIdByScreenName(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if url_ := r.URL.String(); url_ != "/users/lookup.json?include_entities=id&screen_name=bobLeChef" {
-			t.Error("bad url :", url_)
+		if r.ParseForm(); r.Method != "POST" || r.URL.Path != "/users/lookup.json" || len(r.Form) != 1 {
+			t.Error("bad request :", r.Method, r.URL, r.Form)
+		}
+		if r.FormValue("screen_name") != "bobLeChef" {
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"errors": [{"code": 17, "message": "No user matches for specified terms."}]}`)
+			return
 		}
-		fmt.Fprint(w, `[{"id": 1492}]`)
+		fmt.Fprint(w, `[{"id": 1492, "screen_name": "BobLeChef"}]`)
 
 	}))
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 
-	if id, err := tw.GetTwitterIdByScreenName("bobLeChef"); err != nil {
+	if id, err := tw.GetTwitterIdByScreenName(context.Background(), "bobLeChef"); err != nil {
 		t.Error(err)
 	} else if id != 1492 {
 		t.Error("found bad id")
 	}
+	if _, err := tw.GetTwitterIdByScreenName(context.Background(), "alice"); err == nil {
+		t.Error("alice is not found")
+	}
+}
+
+func TestResolveScreenNames(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		names := strings.Split(r.FormValue("screen_name"), ",")
+		if len(names) > 100 {
+			t.Error("too many screen names", len(names))
+		}
+		users := make([]*User, 0)
+		for _, name := range names {
+			// user7 does not exist
+			if id, _ := strconv.ParseUint(strings.TrimPrefix(name, "User"), 10, 64); id != 7 {
+				users = append(users, &User{Id: id + 1000, ScreenName: name})
+			}
+		}
+		json.NewEncoder(w).Encode(users)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	names := make([]string, 150)
+	for i := range names {
+		names[i] = "User" + strconv.Itoa(i)
+	}
+	ids, err := tw.ResolveScreenNames(context.Background(), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Error("the screen names should be resolved in 2 requests", requests)
+	}
+	if len(ids) != 149 || ids["user149"] != 1149 {
+		t.Error("bad ids", len(ids), ids["user149"])
+	}
+	if _, ok := ids["user7"]; ok {
+		t.Error("user7 does not exist")
+	}
+}
+
+func TestFetchIdsOfIdAccount(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if url_ := r.URL.String(); url_ != "/friends/ids.json?count=5000&cursor=-1&user_id=1492" {
+			t.Error("bad url :", url_)
+		}
+		fmt.Fprint(w, `{"ids": [12], "next_cursor_str": "0"}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	if followers, err := tw.FetchIds(context.Background(), Friends, IdAccount(1492), "-1"); err != nil || !reflect.DeepEqual(followers.Followers, []uint64{12}) {
+		t.Error("bad friends", followers, err)
+	}
 }
 
 func TestGetFollowerByCursor(t *testing.T) {
@@ -169,14 +238,14 @@ func TestGetFollowerByCursor(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 
-	followersListC := tw.GetFollowerByCursor("bobLeChef", "89")
+	followersListC := tw.GetFollowerByCursor(context.Background(), "bobLeChef", "89")
 	followers := <-followersListC
 
 	if followers.NextCursor != "1793" {
 		t.Error("bad cursor")
 	} else if len(followers.Followers) != 1 {
 		t.Error("bad number of followers")
-	} else if user := followers.Followers[0]; !reflect.DeepEqual(user, &User{"bob_le_chef", 1492}) {
+	} else if user := followers.Followers[0]; !reflect.DeepEqual(user, &User{ScreenName: "bob_le_chef", Id: 1492}) {
 		t.Error("bad user", user)
 	}
 }
@@ -191,7 +260,7 @@ func TestGetFollowerIdsByCursor(t *testing.T) {
 	defer ts.Close()
 	tw := NewTwitterApi(ts.URL, "access_token")
 
-	followersListC := tw.GetFollowerIdsByCursor("bobLeChef", "89")
+	followersListC := tw.GetFollowerIdsByCursor(context.Background(), "bobLeChef", "89")
 
 	followers := <-followersListC
 
@@ -203,3 +272,96 @@ func TestGetFollowerIdsByCursor(t *testing.T) {
 		t.Error("bad id")
 	}
 }
+
+func TestGetFollowerIdsByCursorIsCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if followers := <-tw.GetFollowerIdsByCursor(ctx, "bobLeChef", "-1"); !errors.Is(followers.Err, context.DeadlineExceeded) {
+		t.Error("the request should be cancelled", followers.Err)
+	}
+}
+
+func TestGetFriendIdsByCursor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if url_ := r.URL.String(); url_ != "/friends/ids.json?count=5000&cursor=-1&screen_name=bobLeChef" {
+			t.Error("bad url :", url_)
+		}
+		fmt.Fprint(w, `{"ids": [1492, 1515], "next_cursor_str": "0"}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	friends := <-tw.GetFriendIdsByCursor(context.Background(), "bobLeChef", "-1")
+
+	if friends.NextCursor != "0" {
+		t.Error("bad cursor")
+	} else if !reflect.DeepEqual(friends.Followers, []uint64{1492, 1515}) {
+		t.Error("bad ids", friends.Followers)
+	}
+}
+
+func TestGetFriendByCursor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if url_ := r.URL.String(); url_ != "/friends/list.json?count=200&cursor=89&screen_name=bobLeChef&skip_status=true" {
+			t.Error("bad url :", url_)
+		}
+		fmt.Fprint(w, `{"users": [{"id": 1492, "screen_name": "bob_le_chef"}], "next_cursor_str": "1793"}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	friends := <-tw.GetFriendByCursor(context.Background(), "bobLeChef", "89")
+
+	if friends.NextCursor != "1793" {
+		t.Error("bad cursor")
+	} else if user := friends.Followers[0]; !reflect.DeepEqual(user, &User{ScreenName: "bob_le_chef", Id: 1492}) {
+		t.Error("bad user", user)
+	}
+}
+
+func TestHydrateUsers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/lookup.json" {
+			t.Error("bad path", r.URL.Path)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "user_id=1492%2C1515%2C1789" {
+			t.Error("bad body", string(body))
+		}
+		fmt.Fprint(w, `[{"id": 1789, "screen_name": "revolution"}, {"id": 1492, "screen_name": "bob_le_chef", "followers_count": 12}]`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	if users, err := tw.HydrateUsers(context.Background(), []uint64{1492, 1515, 1789}); err != nil {
+		t.Error(err)
+	} else if len(users) != 2 || users[1492].FollowersCount != 12 || users[1789].ScreenName != "revolution" {
+		t.Error("bad users", users)
+	}
+
+	lookups := make([]*UserLookup, 0)
+	for lookup := range tw.LookupUsersOfIds(context.Background(), []uint64{1492, 1515, 1789}) {
+		lookups = append(lookups, lookup)
+	}
+	if len(lookups) != 3 || lookups[0].User.ScreenName != "bob_le_chef" || !lookups[1].Missing() || lookups[1].Id != 1515 {
+		t.Error("bad lookups", lookups)
+	}
+}
+
+func TestHydrateUsersWithoutExistingUser(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"errors":[{"code":17,"message":"No user matches for specified terms."}]}`)
+	}))
+	defer ts.Close()
+	tw := NewTwitterApi(ts.URL, "access_token")
+
+	if users, err := tw.HydrateUsers(context.Background(), []uint64{1515}); err != nil || len(users) != 0 {
+		t.Error("no user should be found", users, err)
+	}
+}
@@ -1,8 +1,11 @@
-package main
+package twitterintersection
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
 )
 
@@ -10,18 +13,18 @@ type MockFollowerGetter struct {
 	T *testing.T
 }
 
-func (m *MockFollowerGetter) GetFollowerByCursor(screenName, cursor string) <-chan *FollowerList {
+func (m *MockFollowerGetter) GetUsersByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerList {
 	followerListC := make(chan *FollowerList)
 	go func() {
-		u1 := &User{"nat", 78789}
-		u2 := &User{"jude", 78789}
-		u3 := &User{"alice", 78789}
-		u4 := &User{"bob", 78789}
+		u1 := &User{ScreenName: "nat", Id: 78789}
+		u2 := &User{ScreenName: "jude", Id: 78789}
+		u3 := &User{ScreenName: "alice", Id: 78789}
+		u4 := &User{ScreenName: "bob", Id: 78789}
 		switch cursor {
 		case "-1":
-			followerListC <- &FollowerList{"1", []*User{u1, u2}}
+			followerListC <- &FollowerList{NextCursor: "1", Followers: []*User{u1, u2}}
 		case "1":
-			followerListC <- &FollowerList{"0", []*User{u3, u4}}
+			followerListC <- &FollowerList{NextCursor: "0", Followers: []*User{u3, u4}}
 		case "0":
 		default:
 			m.T.Error("bad cursor", cursor)
@@ -30,14 +33,14 @@ func (m *MockFollowerGetter) GetFollowerByCursor(screenName, cursor string) <-ch
 	return followerListC
 }
 
-func (m *MockFollowerGetter) GetFollowerIdsByCursor(screenName, cursor string) <-chan *FollowerIDList {
+func (m *MockFollowerGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
 	followerListC := make(chan *FollowerIDList)
 	go func() {
 		switch cursor {
 		case "-1":
-			followerListC <- &FollowerIDList{"1", []uint64{1, 2}}
+			followerListC <- &FollowerIDList{NextCursor: "1", Followers: []uint64{1, 2}}
 		case "1":
-			followerListC <- &FollowerIDList{"0", []uint64{3, 4}}
+			followerListC <- &FollowerIDList{NextCursor: "0", Followers: []uint64{3, 4}}
 		case "0":
 		default:
 			m.T.Error("bad cursor", cursor)
@@ -46,11 +49,16 @@ func (m *MockFollowerGetter) GetFollowerIdsByCursor(screenName, cursor string) <
 	return followerListC
 }
 
-func (m *MockFollowerGetter) GetScreenNameOfUsersByIds(ids []uint64) <-chan string {
-	ret := make(chan string)
+func (m *MockFollowerGetter) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	ret := make(chan *UserLookup)
 	go func() {
 		for _, id := range ids {
-			ret <- fmt.Sprintf("%v", id)
+			if id%100 == 13 {
+				// missing users
+				ret <- &UserLookup{Id: id, User: nil}
+			} else {
+				ret <- &UserLookup{Id: id, User: &User{Id: id, ScreenName: fmt.Sprintf("%v", id)}}
+			}
 		}
 		close(ret)
 	}()
@@ -65,27 +73,34 @@ func readAllStringFromChannel(c <-chan string) []string {
 	return ret
 }
 
-func readAllUInt64FromChannel(c <-chan uint64) []uint64 {
+// returns nil when an error is received
+func readAllUInt64FromChannel(c <-chan uint64, errc <-chan error) []uint64 {
 	ret := make([]uint64, 0)
 	for s := range c {
 		ret = append(ret, s)
 	}
+	if err := <-errc; err != nil {
+		return nil
+	}
 	return ret
 }
 
 func TestGetFollowerScreenNames(t *testing.T) {
 	fg := &MockFollowerGetter{t}
-	followerC := GetFollowerScreenNames(fg, "justinBieber")
+	followerC, errc := GetFollowerScreenNames(context.Background(), fg, "justinBieber")
 	followers := readAllStringFromChannel(followerC)
 	expected := []string{"nat", "jude", "alice", "bob"}
 	if !reflect.DeepEqual(followers, expected) {
 		t.Fail()
 	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
 }
 
 func TestGetFollowerIds(t *testing.T) {
 	fg := &MockFollowerGetter{t}
-	ids := readAllUInt64FromChannel(GetFollowerIds(fg, "justinBieber"))
+	ids := readAllUInt64FromChannel(GetFollowerIds(context.Background(), fg, "justinBieber"))
 	expected := []uint64{1, 2, 3, 4}
 	if !reflect.DeepEqual(ids, expected) {
 		t.Error(ids)
@@ -104,10 +119,176 @@ func TestGetScreenNameByIds(t *testing.T) {
 	fg := &MockFollowerGetter{t}
 	ids := uint64Range(233)
 	ret := make(map[string]bool)
-	for name := range GetScreenNameByIds(fg, makeUInt64Channel(ids...)) {
+	screenNameC, errc := GetScreenNameByIds(context.Background(), fg, makeUInt64Channel(ids...))
+	for name := range screenNameC {
 		ret[name] = true
 	}
-	if len(ret) != 233 {
+	if len(ret) != 233-3 || ret["13"] {
+		t.Error("the missing users should be left out", len(ret))
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetFollowerIdsOfAllAccounts(t *testing.T) {
+	fg := &MockFollowerGetter{t}
+	ids := readAllUInt64FromChannel(GetFollowerIdsOfAllAccounts(context.Background(), fg, "alice", "bob", "carol"))
+	if !equalsAsMultiSet(ids, []uint64{1, 2, 3, 4}) {
+		t.Error(ids)
+	}
+}
+
+func TestLookupUsers(t *testing.T) {
+	fg := &MockFollowerGetter{t}
+	ret := make(map[uint64]*User)
+	lookupC, errc := LookupUsers(context.Background(), fg, makeUInt64Channel(uint64Range(233)...))
+	for lookup := range lookupC {
+		ret[lookup.Id] = lookup.User
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+	if len(ret) != 233 || ret[232].ScreenName != "232" {
 		t.Fail()
 	}
+	if ret[13] != nil || ret[113] != nil || ret[213] != nil {
+		t.Error("the missing users should be reported")
+	}
+}
+
+// failingPagesGetter fails the pages of the ids of the accounts in the map
+// with their error, after a first page of ids
+type failingPagesGetter struct {
+	MockFollowerGetter
+	errs map[string]error
+}
+
+func (m *failingPagesGetter) GetIdsByCursor(ctx context.Context, relation Relation, screenName, cursor string) <-chan *FollowerIDList {
+	if err, ok := m.errs[screenName]; ok && cursor != "-1" {
+		followerListC := make(chan *FollowerIDList, 1)
+		followerListC <- &FollowerIDList{Err: err}
+		return followerListC
+	}
+	return m.MockFollowerGetter.GetIdsByCursor(ctx, relation, screenName, cursor)
+}
+
+func (m *failingPagesGetter) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	if err, ok := m.errs["lookup"]; ok {
+		lookupC := make(chan *UserLookup, 1)
+		lookupC <- &UserLookup{Err: err}
+		close(lookupC)
+		return lookupC
+	}
+	return m.MockFollowerGetter.LookupUsersOfIds(ctx, ids)
+}
+
+func TestGetIdsStopsOnError(t *testing.T) {
+	fg := &failingPagesGetter{MockFollowerGetter{t}, map[string]error{"secret": NewTwitterErr("Not authorized.", 401)}}
+	idsC, errc := GetFollowerIds(context.Background(), fg, "secret")
+	if ids := readUInt64Channel(idsC); !reflect.DeepEqual(ids, []uint64{1, 2}) {
+		t.Error("the ids before the error should be sent", ids)
+	}
+	err := <-errc
+	accountErr, ok := err.(*AccountErr)
+	if !ok || accountErr.ScreenName != "secret" || accountErr.Relation != Followers {
+		t.Fatal("expected an AccountErr", err)
+	}
+	if err.Error() != "cannot get the followers of secret: the account is protected" {
+		t.Error("bad message", err)
+	}
+	if _, open := <-errc; open {
+		t.Error("the error channel should be closed")
+	}
+}
+
+func TestAccountErrMessages(t *testing.T) {
+	errs := map[string]error{
+		"cannot get the friends of bob: the account does not exist": &AccountErr{"bob", Friends, NewTwitterErr("", 404)},
+		"cannot get the friends of bob: boom":                       &AccountErr{"bob", Friends, errors.New("boom")},
+	}
+	for expected, err := range errs {
+		if err.Error() != expected {
+			t.Error("expected", expected, "but received", err)
+		}
+	}
+}
+
+func TestGetFollowerIdsOfAllAccountsReportsErrors(t *testing.T) {
+	fg := &failingPagesGetter{MockFollowerGetter{t}, map[string]error{"bob": NewTwitterErr("", 404)}}
+	idsC, errc := GetFollowerIdsOfAllAccounts(context.Background(), fg, "alice", "bob", "carol")
+	readUInt64Channel(idsC)
+	if err := WaitErrors(errc); err == nil || err.(*AccountErr).ScreenName != "bob" {
+		t.Error("expected the error of bob", err)
+	}
+}
+
+func TestLookupUsersStopsOnError(t *testing.T) {
+	fg := &failingPagesGetter{MockFollowerGetter{t}, map[string]error{"lookup": errors.New("boom")}}
+	lookupC, errc := LookupUsers(context.Background(), fg, makeUInt64Channel(uint64Range(233)...))
+	for lookup := range lookupC {
+		t.Error("no lookup should be sent", lookup)
+	}
+	if err := <-errc; err == nil || err.Error() != "boom" {
+		t.Error("expected the lookup error", err)
+	}
+}
+
+// countingLookupGetter fails every lookup and counts them.  A lookup
+// returns once its error is recorded by the caller, then signals failed.
+type countingLookupGetter struct {
+	MockFollowerGetter
+	calls  atomic.Int32
+	failed chan struct{}
+}
+
+func (m *countingLookupGetter) LookupUsersOfIds(ctx context.Context, ids []uint64) <-chan *UserLookup {
+	m.calls.Add(1)
+	lookupC := make(chan *UserLookup)
+	go func() {
+		lookupC <- &UserLookup{Err: errors.New("boom")}
+		// received once the error of the first lookup is handled
+		lookupC <- &UserLookup{Id: ids[0]}
+		close(lookupC)
+		select {
+		case m.failed <- struct{}{}:
+		default:
+		}
+	}()
+	return lookupC
+}
+
+func TestLookupUsersStopsLookingUpOnError(t *testing.T) {
+	fg := &countingLookupGetter{MockFollowerGetter: MockFollowerGetter{t}, failed: make(chan struct{}, 1)}
+	idsC := make(chan uint64)
+	go func() {
+		for _, id := range uint64Range(9500) {
+			if id == 95 {
+				<-fg.failed
+			}
+			idsC <- id
+		}
+		close(idsC)
+	}()
+	lookupC, errc := LookupUsers(context.Background(), fg, idsC)
+	for lookup := range lookupC {
+		t.Error("no lookup should be sent", lookup)
+	}
+	if err := <-errc; err == nil || err.Error() != "boom" {
+		t.Error("expected the lookup error", err)
+	}
+	if calls := fg.calls.Load(); calls != 1 {
+		t.Error("no lookup should be requested after the first failure", calls)
+	}
+}
+
+func TestGetIdsStopsWithTheContext(t *testing.T) {
+	fg := &MockFollowerGetter{t}
+	ctx, cancel := context.WithCancel(context.Background())
+	idsC, errc := GetFollowerIds(ctx, fg, "justinBieber")
+	<-idsC
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Error("expected the error of the context", err)
+	}
 }
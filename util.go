@@ -1,28 +1,64 @@
-package main
+package twitterintersection
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
-// returns all the element x that are in c1 and c2.  can retuns many time
-// the same x.
-func intersection(c1, c2 <-chan uint64) <-chan uint64 {
-	var wg sync.WaitGroup
-	out := make(chan uint64)
+// receives an element of c.  ok is false once c is closed or ctx is done.
+func receive(ctx context.Context, c <-chan uint64) (n uint64, ok bool) {
+	select {
+	case n, ok = <-c:
+		return n, ok
+	case <-ctx.Done():
+		return 0, false
+	}
+}
 
-	mc1, mc2 := make(map[uint64]bool), make(map[uint64]bool)
+// sends n in c and returns true, or returns false if ctx is done first.
+func send(ctx context.Context, c chan<- uint64, n uint64) bool {
+	select {
+	case c <- n:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	filter := func(c <-chan uint64, mapToAdd, mapToVerify map[uint64]bool) {
-		for n := range c {
-			mapToAdd[n] = true
-			if _, ok := mapToVerify[n]; ok {
-				out <- n
+// reads every channels of cs concurrently until they are closed, or ctx is
+// done, and returns their content as sets.
+func collect(ctx context.Context, cs ...<-chan uint64) []IdSet {
+	var wg sync.WaitGroup
+	sets := make([]IdSet, len(cs))
+	wg.Add(len(cs))
+	for i, c := range cs {
+		go func(i int, c <-chan uint64) {
+			var builder idSetBuilder
+			for n, ok := receive(ctx, c); ok; n, ok = receive(ctx, c) {
+				builder.Add(n)
 			}
-		}
-		wg.Done()
+			sets[i] = builder.Build()
+			wg.Done()
+		}(i, c)
 	}
-	wg.Add(2)
-	go filter(c1, mc1, mc2)
-	go filter(c2, mc2, mc1)
+	wg.Wait()
+	return sets
+}
 
+// returns a channel receiving the errors of all the channels of errcs,
+// closed once they are all closed.
+func mergeErrors(errcs ...<-chan error) <-chan error {
+	var wg sync.WaitGroup
+	out := make(chan error, len(errcs))
+	wg.Add(len(errcs))
+	for _, errc := range errcs {
+		go func(errc <-chan error) {
+			for err := range errc {
+				out <- err
+			}
+			wg.Done()
+		}(errc)
+	}
 	go func() {
 		wg.Wait()
 		close(out)
@@ -30,24 +66,85 @@ func intersection(c1, c2 <-chan uint64) <-chan uint64 {
 	return out
 }
 
-// remove all duplicates in inputC
-func uniq(inputC <-chan uint64) <-chan uint64 {
-	m := make(map[uint64]bool)
+// WaitErrors reads all the channels of errcs until they are closed and
+// returns the first error received, if any.
+func WaitErrors(errcs ...<-chan error) error {
+	var first error
+	for err := range mergeErrors(errcs...) {
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// IdsChannel sends the ids in a channel closed afterward, or as soon as ctx
+// is done.
+func IdsChannel(ctx context.Context, ids []uint64) <-chan uint64 {
 	c := make(chan uint64)
 	go func() {
-		for n := range inputC {
-			if _, ok := m[n]; !ok {
-				m[n] = true
-				c <- n
+		defer close(c)
+		for _, id := range ids {
+			if !send(ctx, c, id) {
+				return
 			}
 		}
-		close(c)
 	}()
 	return c
 }
 
-// returns the intersection of a and b without repetitions
-func Intersection(a, b <-chan uint64) <-chan uint64 {
-	return uniq(intersection(a, b))
+// sends, in increasing order, the ids of the set computed by f in its own
+// goroutine, in a channel closed afterward or as soon as ctx is done
+func sendIdSet(ctx context.Context, f func() IdSet) <-chan uint64 {
+	c := make(chan uint64)
+	go func() {
+		defer close(c)
+		for _, id := range f() {
+			if !send(ctx, c, id) {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// The set operators below read all their inputs before returning anything,
+// in increasing order and without repetitions.  They stop reading their
+// inputs and close their output as soon as ctx is done.
+
+// returns the intersection of all the channels
+func Intersection(ctx context.Context, cs ...<-chan uint64) <-chan uint64 {
+	return sendIdSet(ctx, func() IdSet {
+		return IntersectIdSets(collect(ctx, cs...)...)
+	})
+}
+
+// returns all the element that are in at least one of the channels
+func Union(ctx context.Context, cs ...<-chan uint64) <-chan uint64 {
+	return sendIdSet(ctx, func() IdSet {
+		return UnionIdSets(collect(ctx, cs...)...)
+	})
+}
+
+// returns all the element that are in at least k of the channels
+func AtLeast(ctx context.Context, k int, cs ...<-chan uint64) <-chan uint64 {
+	return sendIdSet(ctx, func() IdSet {
+		return AtLeastIdSets(k, collect(ctx, cs...)...)
+	})
+}
+
+// returns all the element of a that are not in b
+func Difference(ctx context.Context, a, b <-chan uint64) <-chan uint64 {
+	return sendIdSet(ctx, func() IdSet {
+		sets := collect(ctx, a, b)
+		return sets[0].Difference(sets[1])
+	})
+}
 
+// returns all the element that are either in a or in b but not in both
+func SymmetricDifference(ctx context.Context, a, b <-chan uint64) <-chan uint64 {
+	return sendIdSet(ctx, func() IdSet {
+		sets := collect(ctx, a, b)
+		return sets[0].SymmetricDifference(sets[1])
+	})
 }
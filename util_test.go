@@ -1,6 +1,7 @@
-package main
+package twitterintersection
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -44,27 +45,89 @@ func equalsAsMultiSet(a, b []uint64) bool {
 	return reflect.DeepEqual(aSet, bSet)
 }
 
-func TestUniq(t *testing.T) {
+func TestOperatorsRemoveRepetitions(t *testing.T) {
 	c := makeUInt64Channel(1, 3, 2, 1, 4, 3, 3, 2, 1)
-	expt := []uint64{1, 3, 2, 4}
-	if ret := readUInt64Channel(uniq(c)); !reflect.DeepEqual(expt, ret) {
-		t.Fail()
+	expt := []uint64{1, 2, 3, 4}
+	if ret := readUInt64Channel(Union(context.Background(), c)); !reflect.DeepEqual(expt, ret) {
+		t.Error(ret)
 	}
 }
 
 func TestIntersection(t *testing.T) {
-	c := Intersection(makeUInt64Channel(1, 2, 3, 4), makeUInt64Channel(1, 2, 3, 4))
+	c := Intersection(context.Background(), makeUInt64Channel(1, 2, 3, 4), makeUInt64Channel(1, 2, 3, 4))
 	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 2, 3, 4}) {
 		t.Error("needed {1, 2, 3 , 4} received ", s)
 	}
 
-	c = Intersection(makeUInt64Channel(1, 2), makeUInt64Channel(1, 2, 3, 4))
+	c = Intersection(context.Background(), makeUInt64Channel(1, 2), makeUInt64Channel(1, 2, 3, 4))
 	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 2}) {
 		t.Error("needed {1, 2} received ", s)
 	}
 
-	c = Intersection(makeUInt64Channel(3, 4), makeUInt64Channel(1, 2, 3, 4))
+	c = Intersection(context.Background(), makeUInt64Channel(3, 4), makeUInt64Channel(1, 2, 3, 4))
 	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{3, 4}) {
 		t.Error("needed {3 , 4} received ", s)
 	}
 }
+
+func TestIntersectionOfManyChannels(t *testing.T) {
+	c := Intersection(context.Background(), makeUInt64Channel(1, 2, 3, 4, 5), makeUInt64Channel(2, 3, 4, 5), makeUInt64Channel(5, 3, 1))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{3, 5}) {
+		t.Error("needed {3, 5} received ", s)
+	}
+
+	c = Intersection(context.Background(), makeUInt64Channel(1, 1, 2), makeUInt64Channel(2, 2), makeUInt64Channel(2, 1))
+	if s := readUInt64Channel(c); !reflect.DeepEqual(s, []uint64{2}) {
+		t.Error("needed {2} received ", s)
+	}
+
+	c = Intersection(context.Background(), makeUInt64Channel(1, 2, 3))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 2, 3}) {
+		t.Error("needed {1, 2, 3} received ", s)
+	}
+
+	if s := readUInt64Channel(Intersection(context.Background())); len(s) != 0 {
+		t.Error("needed {} received ", s)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	c := Union(context.Background(), makeUInt64Channel(1, 2, 2), makeUInt64Channel(2, 3), makeUInt64Channel(4))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 2, 3, 4}) || len(s) != 4 {
+		t.Error("needed {1, 2, 3, 4} received ", s)
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	c := AtLeast(context.Background(), 2, makeUInt64Channel(1, 2, 3), makeUInt64Channel(2, 3, 4), makeUInt64Channel(3, 4, 5), makeUInt64Channel(6, 6))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{2, 3, 4}) || len(s) != 3 {
+		t.Error("needed {2, 3, 4} received ", s)
+	}
+}
+
+func TestDifference(t *testing.T) {
+	c := Difference(context.Background(), makeUInt64Channel(1, 2, 3, 4, 1), makeUInt64Channel(2, 4, 5))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 3}) || len(s) != 2 {
+		t.Error("needed {1, 3} received ", s)
+	}
+}
+
+func TestSymmetricDifference(t *testing.T) {
+	c := SymmetricDifference(context.Background(), makeUInt64Channel(1, 2, 3, 4), makeUInt64Channel(2, 4, 5, 5))
+	if s := readUInt64Channel(c); !equalsAsMultiSet(s, []uint64{1, 3, 5}) || len(s) != 3 {
+		t.Error("needed {1, 3, 5} received ", s)
+	}
+}
+
+func TestSetOperatorsStopWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// never closed
+	a, b := make(chan uint64), make(chan uint64)
+	cs := []<-chan uint64{Intersection(ctx, a, b), Union(ctx, a, b), Difference(ctx, a, b), SymmetricDifference(ctx, a, b)}
+	cancel()
+	for _, c := range cs {
+		if s := readUInt64Channel(c); len(s) != 0 {
+			t.Error("nothing should be received", s)
+		}
+	}
+}